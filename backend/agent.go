@@ -1,50 +1,139 @@
 package backend
 
 import (
-	"bytes"
-	"encoding/binary"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
 	"strings"
-	"sync"
 	"time"
 )
 
+// NeoAgent supervises machbase-neo, the lifecycle is ManagedProcess
+// with the health check, the heartbeat watchdog and the shutdown over navelcord.
 type NeoAgent struct {
-	makeLaunchFlags  func() *LaunchCmdWithFlags
-	stdoutWriter     io.Writer
-	stderrWriter     io.Writer
-	logWriter        io.Writer
-	process          *os.Process
-	processWg        sync.WaitGroup
-	stateC           chan NeoState
-	stateCallback    func(NeoState)
-	navelcordEnabled bool
-	navelcordLsnr    *net.TCPListener
-	navelcord        net.Conn
+	*ManagedProcess
+	makeLaunchFlags func() *LaunchCmdWithFlags
+	healthCallback  func(Health)
+	healthInterval  func() time.Duration
+	watchdog        func() WatchdogOptions
+	// guarded by statusLock
+	health        Health
+	heartbeat     heartbeatTracker
+	bindAddr      guess
+	serverMetrics map[string]any
 }
 
+// NeoState is the state of a ManagedProcess
 type NeoState string
 
 const (
-	NeoStarting NeoState = "starting"
-	NeoRunning  NeoState = "running"
-	NeoStopping NeoState = "stopping"
-	NeoStopped  NeoState = "not running"
+	NeoStarting    NeoState = "starting"
+	NeoRunning     NeoState = "running"
+	NeoRestarting  NeoState = "restarting"
+	NeoStopping    NeoState = "stopping"
+	NeoTerminating NeoState = "terminating"
+	NeoKilling     NeoState = "killing"
+	NeoStopped     NeoState = "not running"
+	NeoFailed      NeoState = "failed"
+)
+
+// NeoStatus is what the state callback receives on every state change
+type NeoStatus struct {
+	Instance string   `json:"instance,omitempty"`
+	State    NeoState `json:"state"`
+	Pid      int      `json:"pid,omitempty"`
+	Restarts int      `json:"restarts"`
+	LastExit string   `json:"lastExit,omitempty"`
+	ExitCode int      `json:"exitCode,omitempty"` // of the last exit, -1 if it was not reaped normally
+	Reason   string   `json:"reason,omitempty"`   // why the process is failed
+}
+
+const defaultStopTimeout = 10 * time.Second
+
+// defaultReadyTimeout is how long the server can take until it answers the health check
+const defaultReadyTimeout = time.Minute
+
+type RestartPolicy string
+
+const (
+	RestartNever     RestartPolicy = "never"
+	RestartOnFailure RestartPolicy = "on-failure"
+	RestartAlways    RestartPolicy = "always"
+)
+
+// RestartOptions decides whether the server is relaunched when it exits without StopServer.
+// The delay between restarts doubles from Backoff up to BackoffMax,
+// the consecutive failure count is reset when the server stays up longer than BackoffMax.
+type RestartOptions struct {
+	Policy     RestartPolicy
+	MaxRetries int
+	Backoff    time.Duration
+	BackoffMax time.Duration
+}
+
+const (
+	defaultRestartMaxRetries = 5
+	defaultRestartBackoff    = time.Second
+	defaultRestartBackoffMax = time.Minute
 )
 
 type Option func(*NeoAgent)
 
+// serverHooks are what differ between the server agents of the GUI and the headless launcher
+type serverHooks struct {
+	stdout      io.Writer
+	stderr      io.Writer
+	log         io.Writer
+	navel       *NavelServer
+	onState     func(NeoStatus)
+	onHealth    func(Health)
+	onPreflight func(error) // receives the error of the preflight check
+}
+
+// newServerAgent creates the agent of machbase-neo that follows the launch options returned by launchOptions
+func newServerAgent(launchOptions func() *LaunchOptions, hooks serverHooks) *NeoAgent {
+	var na *NeoAgent
+	na = NewNeoAgent(
+		WithStdoutWriter(hooks.stdout),
+		WithStderrWriter(hooks.stderr),
+		WithLogWriter(hooks.log),
+		WithNavelcordEnabled(true),
+		WithNavelServer(hooks.navel),
+		WithNavelLegacy(func() bool { return launchOptions().NavelcordLegacy }),
+		WithStateCallback(hooks.onState),
+		WithLaunchFlags(func() *LaunchCmdWithFlags { return launchOptions().launchFlags() }),
+		WithStopTimeout(func() time.Duration { return launchOptions().stopTimeout() }),
+		WithReadyTimeout(func() time.Duration { return launchOptions().readyTimeout() }),
+		WithHealthInterval(func() time.Duration { return launchOptions().healthInterval() }),
+		WithHeartbeatWatchdog(func() WatchdogOptions { return launchOptions().watchdogOptions() }),
+		WithHealthCallback(hooks.onHealth),
+		WithRestartPolicy(func() RestartOptions { return launchOptions().restartOptions() }),
+		WithPreflight(func() error {
+			err := launchOptions().preflight(na.log)
+			if err != nil && hooks.onPreflight != nil {
+				hooks.onPreflight(err)
+			}
+			return err
+		}),
+	)
+	return na
+}
+
 func NewNeoAgent(opts ...Option) *NeoAgent {
 	neoAgent := &NeoAgent{
-		stateC: make(chan NeoState),
+		ManagedProcess: newManagedProcess("machbase-neo"),
+		bindAddr:       defaultBindAddress,
 	}
+	neoAgent.command = neoAgent.serveCommand
+	neoAgent.readyCheck = neoAgent.checkReady
+	neoAgent.onReady = neoAgent.superviseReady
+	neoAgent.requestStop = neoAgent.requestShutdown
+	neoAgent.onNavel = neoAgent.handleNavelMessage
 	for _, opt := range opts {
 		opt(neoAgent)
 	}
@@ -69,7 +158,7 @@ func WithLogWriter(writer io.Writer) Option {
 	}
 }
 
-func WithStateCallback(cb func(NeoState)) Option {
+func WithStateCallback(cb func(NeoStatus)) Option {
 	return func(na *NeoAgent) {
 		na.stateCallback = cb
 	}
@@ -81,44 +170,76 @@ func WithLaunchFlags(fn func() *LaunchCmdWithFlags) Option {
 	}
 }
 
-func WithNavelcordEnabled(flag bool) Option {
+// WithStopTimeout sets the grace period of each stage of StopServer
+func WithStopTimeout(fn func() time.Duration) Option {
 	return func(na *NeoAgent) {
-		na.navelcordEnabled = flag
+		na.stopTimeout = fn
 	}
 }
 
-func (na *NeoAgent) Open() {
-	if na.process != nil {
-		na.stateC <- NeoRunning
-		return
+// WithRestartPolicy sets the policy applied when the server exits unexpectedly
+func WithRestartPolicy(fn func() RestartOptions) Option {
+	return func(na *NeoAgent) {
+		na.restartPolicy = fn
 	}
-	go func() {
-		for state := range na.stateC {
-			if na.stateCallback == nil {
-				continue
-			}
-			na.stateCallback(state)
-		}
-	}()
-	na.stateC <- NeoStopped
+}
 
-	if na.navelcordEnabled {
-		na.runNavelCordServer()
+// WithPreflight sets the check that runs before StartServer launches the server
+func WithPreflight(fn func() error) Option {
+	return func(na *NeoAgent) {
+		na.preflight = fn
 	}
 }
 
-func (na *NeoAgent) Close() {
-	if na.navelcordLsnr != nil {
-		na.navelcordLsnr.Close()
+// WithReadyTimeout sets how long the server can stay in starting, it turns to failed after the timeout
+func WithReadyTimeout(fn func() time.Duration) Option {
+	return func(na *NeoAgent) {
+		na.readyTimeout = fn
+	}
+}
+
+func WithNavelcordEnabled(flag bool) Option {
+	return func(na *NeoAgent) {
+		na.navelcordEnabled = flag
+	}
+}
+
+// WithNavelLegacy sets whether the server may connect to navelcord without token, see NavelChild.AllowLegacy
+func WithNavelLegacy(fn func() bool) Option {
+	return func(na *NeoAgent) {
+		na.navelLegacy = fn
 	}
-	if na.stateC != nil {
-		close(na.stateC)
+}
+
+// WithNavelServer makes the agent register to the navelcord server shared with other children,
+// the agent creates its own server if it is not given.
+func WithNavelServer(srv *NavelServer) Option {
+	return func(na *NeoAgent) {
+		na.navelServer = srv
 	}
 }
 
+// bindAddress returns the best guess of the addresses that the server listens
+func (na *NeoAgent) bindAddress() guess {
+	na.statusLock.Lock()
+	defer na.statusLock.Unlock()
+	return na.bindAddr
+}
+
+// StartServer launches the server, the state callback receives the result
 func (na *NeoAgent) StartServer() {
-	na.stateC <- NeoStarting
+	na.Start()
+}
+
+// StopServer stops the server in stages.
+// It asks the server to shutdown first, then sends a terminate signal to the process group,
+// and finally kills the process group if it still does not exit within the grace period.
+func (na *NeoAgent) StopServer() {
+	na.Stop()
+}
 
+// serveCommand builds the command of 'machbase-neo serve' with the launch flags
+func (na *NeoAgent) serveCommand() (*exec.Cmd, error) {
 	pname := ""
 	pargs := []string{}
 	launch := na.makeLaunchFlags()
@@ -134,94 +255,69 @@ func (na *NeoAgent) StartServer() {
 		pargs = append(pargs, launch.Flags...)
 	}
 	cmd := exec.Command(pname, pargs...)
-	cmd.Env = os.Environ()
-	if v := na.navelcordEnv(); na.navelcordEnabled && v != "" {
-		cmd.Env = append(cmd.Env, v)
-	}
-	sysProcAttr(cmd)
+	cmd.Env = launch.environ(os.Environ())
+
+	na.statusLock.Lock()
+	na.bindAddr = guessBindAddress(pargs)
+	na.heartbeat = heartbeatTracker{}
+	na.serverMetrics = nil
+	na.statusLock.Unlock()
+	return cmd, nil
+}
 
-	if na.stdoutWriter != nil {
-		stdout, _ := cmd.StdoutPipe()
-		go io.Copy(na.stdoutWriter, stdout)
-	}
-	if na.stderrWriter != nil {
-		stderr, _ := cmd.StderrPipe()
-		go io.Copy(na.stderrWriter, stderr)
-	}
+var readyCheckClient = &http.Client{Timeout: time.Second}
 
-	if err := cmd.Start(); err != nil {
-		na.log(err.Error())
-		return
+// checkReady asks the health check over HTTP,
+// any answer of the http server means it is serving, e.g. 401 with token auth
+func (na *NeoAgent) checkReady() error {
+	rsp, err := readyCheckClient.Get("http://" + na.bindAddress().httpAddr + "/web/api/check")
+	if err != nil {
+		return err
 	}
-	na.process = cmd.Process
-
-	bestGuess = guessBindAddress(pargs)
-
-	na.processWg.Add(1)
-	go func() {
-		na.stateC <- NeoRunning
-		state, err := na.process.Wait()
-		na.processWg.Done()
-		if err != nil {
-			na.log(fmt.Sprintf("Shutdown failed %s", err.Error()))
-		} else {
-			na.log(fmt.Sprintf("Shutdown done (exit code: %d)", state.ExitCode()))
-		}
-		na.process = nil
-		na.stateC <- NeoStopped
-	}()
+	rsp.Body.Close()
+	if rsp.StatusCode >= http.StatusInternalServerError {
+		return errors.New(rsp.Status)
+	}
+	return nil
 }
 
-func (na *NeoAgent) StopServer() {
-	na.stateC <- NeoStopping
-	if na.navelcord != nil {
-		na.navelcord.Close()
-	}
-	if na.process != nil {
-		na.processWg.Wait()
-	}
-	na.stateC <- NeoStopped
+// superviseReady watches the heartbeats and monitors the health of the server until exit
+func (na *NeoAgent) superviseReady(exitC <-chan struct{}) {
+	go na.watchHeartbeat(exitC)
+	na.monitorHealth(exitC)
 }
 
-func (na *NeoAgent) navelcordEnv() string {
-	if na.navelcordLsnr != nil {
-		navelPort := strings.TrimPrefix(na.navelcordLsnr.Addr().String(), "127.0.0.1:")
-		return fmt.Sprintf("%s=%s", NAVEL_ENV, navelPort)
+// requestShutdown sends the shutdown message over navelcord,
+// or runs 'machbase-neo shell shutdown' if the server does not understand it.
+func (na *NeoAgent) requestShutdown(timeout time.Duration) {
+	if na.negotiatedNavelVersion() < 1 || na.sendNavel(&NavelShutdown{Reason: "stopped by launcher"}) != nil {
+		if na.navel != nil {
+			na.navel.Disconnect()
+		}
+		go na.shutdown(timeout)
 	}
-	return ""
 }
 
-func (na *NeoAgent) runNavelCordServer() {
-	if lsnr, err := net.Listen("tcp", "127.0.0.1:0"); err == nil {
-		na.navelcordLsnr = lsnr.(*net.TCPListener)
+// shutdown runs 'machbase-neo shell shutdown' against the running server
+func (na *NeoAgent) shutdown(timeout time.Duration) {
+	pname := ""
+	pargs := []string{}
+	launch := na.makeLaunchFlags()
+	if runtime.GOOS == "windows" {
+		pname = "cmd.exe"
+		pargs = append(pargs, "/c")
+		pargs = append(pargs, launch.BinPath)
+	} else {
+		pname = launch.BinPath
+	}
+	pargs = append(pargs, "shell", "--server", "tcp://"+na.bindAddress().grpcAddr, "shutdown")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, pname, pargs...)
+	sysProcAttr(cmd)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		na.log(fmt.Sprintf("Shutdown request failed %s %s", err.Error(), strings.TrimSpace(string(out))))
 	}
-	go func() {
-		for {
-			if conn, err := na.navelcordLsnr.Accept(); err != nil {
-				// when launcher is shutdown
-				break
-			} else {
-				na.navelcord = conn
-			}
-			for {
-				hb := Heartbeat{}
-				if err := hb.Unmarshal(na.navelcord); err != nil {
-					break
-				}
-
-				hb.Ack = time.Now().UnixNano()
-				if pkt, err := hb.Marshal(); err != nil {
-					break
-				} else {
-					na.navelcord.Write(pkt)
-				}
-			}
-			if na.navelcord != nil {
-				na.navelcord.Close()
-				na.navelcord = nil
-			}
-		}
-	}()
 }
 
 func (na *NeoAgent) Version() {
@@ -254,56 +350,3 @@ func (na *NeoAgent) Version() {
 		panic(err)
 	}
 }
-
-func (na *NeoAgent) log(msg string, args ...any) {
-	if na.logWriter != nil {
-		fmt.Fprintln(na.logWriter, append([]any{msg}, args...)...)
-	}
-}
-
-const NAVEL_ENV = "NEOSHELL_NAVELCORD"
-const NAVEL_STX = 0x4E
-const NAVEL_HEARTBEAT = 1
-
-type Heartbeat struct {
-	Timestamp int64 `json:"ts"`
-	Ack       int64 `json:"ack,omitempty"`
-}
-
-func (hb *Heartbeat) Marshal() ([]byte, error) {
-	body, err := json.Marshal(hb)
-	if err != nil {
-		return nil, err
-	}
-	buf := &bytes.Buffer{}
-	buf.Write([]byte{NAVEL_STX, NAVEL_HEARTBEAT})
-	hdr := make([]byte, 4)
-	binary.BigEndian.PutUint32(hdr, uint32(len(body)))
-	buf.Write(hdr)
-	buf.Write(body)
-	return buf.Bytes(), nil
-}
-
-func (hb *Heartbeat) Unmarshal(r io.Reader) error {
-	hdr := make([]byte, 2)
-	bodyLen := make([]byte, 4)
-
-	n, err := r.Read(hdr)
-	if err != nil || n != 2 || hdr[0] != NAVEL_STX || hdr[1] != NAVEL_HEARTBEAT {
-		return errors.New("invalid header stx")
-	}
-	n, err = r.Read(bodyLen)
-	if err != nil || n != 4 {
-		return errors.New("invalid body length")
-	}
-	l := binary.BigEndian.Uint32(bodyLen)
-	body := make([]byte, l)
-	n, err = r.Read(body)
-	if err != nil || uint32(n) != l {
-		return errors.New("invalid body")
-	}
-	if err := json.Unmarshal(body, hb); err != nil {
-		return fmt.Errorf("invalid format %s", err.Error())
-	}
-	return nil
-}
@@ -1,17 +1,19 @@
 package backend
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -22,22 +24,38 @@ import (
 type EventType string
 
 const (
-	EVT_TERM  EventType = "term"
-	EVT_LOG   EventType = "log"
-	EVT_STATE EventType = "state"
-	EVT_FLAGS EventType = "flags"
+	EVT_TERM   EventType = "term"
+	EVT_LOG    EventType = "log"
+	EVT_STATE  EventType = "state"
+	EVT_FLAGS  EventType = "flags"
+	EVT_ERROR  EventType = "error"
+	EVT_HEALTH EventType = "health"
+	EVT_NEOCAT EventType = "neocat"
 )
 
 // App struct
 type App struct {
 	ctx     context.Context
-	na      *NeoAgent
 	naReady sync.WaitGroup
 
-	neocatAgent *NeoCatAgent
+	instances     map[string]*Instance
+	instancesLock sync.Mutex
 
-	logBuffer      *bytes.Buffer
-	logBufferLimit int
+	// confLock guards the profiles and the active profile of conf, and the ids of the instances.
+	// It is taken before instancesLock.
+	confLock sync.RWMutex
+	// headlessProfile is the profile chosen by 'neo-launcher --profile', it overrides the active profile
+	// only for the headless run and is never saved.
+	headlessProfile string
+
+	neocatAgents []*NeoCatAgent // an agent per collector, the default collector first
+	neocatLock   sync.Mutex     // guards neocatAgents, neocatFor, neocatResume and conf.NeoCatOptions, taken before confLock
+	neocatFor    string         // the instance that neocat pushes the metrics to
+	neocatResume bool           // neocat was stopped with the server, start it again when the server is ready
+
+	// navelcord server shared by all supervised children, see sharedNavelServer()
+	navel     *NavelServer
+	navelOnce sync.Once
 
 	conf                     Config
 	configFilename           string
@@ -48,16 +66,15 @@ type App struct {
 // NewApp creates a new App application struct
 func NewApp() *App {
 	return &App{
-		logBuffer:      &bytes.Buffer{},
-		logBufferLimit: 128 * 1024,
+		instances: map[string]*Instance{},
 		conf: Config{
 			UI: UIOptions{
 				Theme: "sl-theme-light",
 			},
-			LaunchOptions: &LaunchOptions{
-				Host:     "127.0.0.1",
-				LogLevel: "INFO",
+			Profiles: []*Profile{
+				{Name: defaultProfileName, LaunchOptions: defaultLaunchOptions()},
 			},
+			ActiveProfile: defaultProfileName,
 			NeoCatOptions: &NeoCatOptions{
 				Interval:  "1s",
 				DestTable: "EXAMPLE",
@@ -71,12 +88,23 @@ func NewApp() *App {
 
 type Config struct {
 	UI            UIOptions      `json:"ui"`
-	LaunchOptions *LaunchOptions `json:"launchOptions,omitempty"`
+	Profiles      []*Profile     `json:"profiles,omitempty"`
+	ActiveProfile string         `json:"activeProfile,omitempty"`
 	NeoCatOptions *NeoCatOptions `json:"neoCatOptions,omitempty"`
+	// Navelcord is the transport of the navelcord, "tcp" (default) or "unix"
+	Navelcord NavelTransport `json:"navelcord,omitempty"`
+
+	// Deprecated: moved into Profiles, only for reading old config files
+	LaunchOptions *LaunchOptions `json:"launchOptions,omitempty"`
 }
 
 type UIOptions struct {
-	Theme          string   `json:"theme"`
+	Theme string `json:"theme"`
+	// the capacity of the log of each instance, defaultLogMaxLines and defaultLogMaxBytes if 0
+	LogMaxLines int `json:"logMaxLines,omitempty"`
+	LogMaxBytes int `json:"logMaxBytes,omitempty"`
+
+	// Deprecated: moved into Profiles, only for reading old config files
 	RecentDirList  []string `json:"recentDirList,omitempty"`
 	RecentFileList []string `json:"recentFileList,omitempty"`
 }
@@ -96,6 +124,27 @@ type LaunchOptions struct {
 	JwtAtExpire         string `json:"jwtAtExpire,omitempty"`
 	JwtRtExpire         string `json:"jwtRtExpire,omitempty"`
 	Experiment          bool   `json:"experiment,omitempty"`
+	StopTimeout         string `json:"stopTimeout,omitempty"`
+	ReadyTimeout        string `json:"readyTimeout,omitempty"`
+	HealthInterval      string `json:"healthInterval,omitempty"`
+	HeartbeatInterval   string `json:"heartbeatInterval,omitempty"`
+	HeartbeatMissLimit  int    `json:"heartbeatMissLimit,omitempty"`
+	HeartbeatAction     string `json:"heartbeatAction,omitempty"`
+	RestartPolicy       string `json:"restartPolicy,omitempty"`
+	RestartMaxRetries   int    `json:"restartMaxRetries,omitempty"`
+	RestartBackoff      string `json:"restartBackoff,omitempty"`
+	RestartBackoffMax   string `json:"restartBackoffMax,omitempty"`
+	// NavelcordLegacy lets the server connect to navelcord without token, for the releases that do not send hello.
+	// It works only with the unix transport, where the launcher verifies the pid of the peer.
+	NavelcordLegacy bool `json:"navelcordLegacy,omitempty"`
+
+	// Flags holds the values of serve flags that have no typed field above, see serveFlags
+	Flags map[string]string `json:"flags,omitempty"`
+	// ExtraArgs are appended to the serve command as they are, for the flags the launcher doesn't know
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+	// Env overrides the environment variables of the server, a null value unsets the variable.
+	// Only ${VAR} in the values is expanded with the environment of the launcher, other '$' are kept.
+	Env map[string]*string `json:"env,omitempty"`
 }
 
 type NeoCatOptions struct {
@@ -105,8 +154,14 @@ type NeoCatOptions struct {
 	InputCPU   bool   `json:"inputCPU"`
 	InputMem   bool   `json:"inputMem"`
 	OutputFile string `json:"outputFile,omitempty"`
-	Pid        int    `json:"pid"`
-	BinPath    string `json:"binPath,omitempty"`
+	Pid        int    `json:"pid,omitempty"`       // of the running neocat, filled by DoGetNeoCatLauncher and never saved
+	BinPath    string `json:"binPath,omitempty"`   // next to machbase-neo, filled by DoGetNeoCatLauncher and never saved
+	AutoStart  bool   `json:"autoStart,omitempty"` // start neocat whenever the server of the active profile is ready
+
+	Token      string             `json:"token,omitempty"`      // for the server that enables the token auth
+	Inputs     []NeoCatInput      `json:"inputs,omitempty"`     // more inputs of the default collector
+	Outputs    []NeoCatOutput     `json:"outputs,omitempty"`    // outputs of the default collector
+	Collectors []*NeoCatCollector `json:"collectors,omitempty"` // run along with the default collector
 }
 
 // startup is called when the app starts. The context is saved
@@ -123,7 +178,7 @@ func (a *App) Startup(ctx context.Context) {
 	if len(os.Args) > 1 {
 		binPath = os.Args[1]
 	} else {
-		binPath = a.conf.LaunchOptions.BinPath
+		binPath = a.launchOptions().BinPath
 	}
 
 	cwdPath, _ := os.Executable()
@@ -185,25 +240,16 @@ select_bin_path:
 		}
 		wailsRuntime.Quit(ctx)
 	}
-	if a.conf.LaunchOptions.BinPath != binPath {
-		a.conf.LaunchOptions.BinPath = binPath
+	if a.launchOptions().BinPath != binPath {
+		a.setBinPath(binPath)
 		a.saveLaunchOptions()
 	}
 	a.ctx = ctx
-	a.na = NewNeoAgent(
-		WithStdoutWriter(NewAppWriter(a, EVT_TERM)),
-		WithStderrWriter(NewAppWriter(a, EVT_TERM)),
-		WithLogWriter(NewAppWriter(a, EVT_LOG)),
-		WithNavelcordEnabled(true),
-		WithStateCallback(func(state NeoState) {
-			wailsRuntime.EventsEmit(a.ctx, string(EVT_STATE), state)
-		}),
-		WithLaunchFlags(a.makeLaunchFlags),
-	)
+	a.discoverFlags(binPath)
 }
 
 func (a *App) BeforeClose(ctx context.Context) bool {
-	if a.na != nil && a.na.process != nil {
+	if running := a.runningInstances(); len(running) > 0 {
 		rsp, err := wailsRuntime.MessageDialog(a.ctx, wailsRuntime.MessageDialogOptions{
 			Type:          wailsRuntime.QuestionDialog,
 			Title:         "Server is running",
@@ -215,16 +261,51 @@ func (a *App) BeforeClose(ctx context.Context) bool {
 		if (rsp == "Cancel" || rsp == "No") && err == nil {
 			return true
 		}
-		a.na.StopServer()
+		wg := sync.WaitGroup{}
+		for _, inst := range running {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				inst.agent.StopServer()
+			}()
+		}
+		wg.Wait()
 	}
 	return false
 }
 
 func (a *App) Shutdown(ctx context.Context) {
-	a.na.Close()
+	a.neocatLock.Lock()
+	a.stopNeoCat()
+	a.neocatLock.Unlock()
+	a.instancesLock.Lock()
+	for _, inst := range a.instances {
+		inst.agent.Close()
+	}
+	a.instancesLock.Unlock()
+	if a.navel != nil {
+		a.navel.Close()
+	}
 	a.saveLaunchOptions()
 }
 
+// sharedNavelServer returns the navelcord server that the supervised children connect to,
+// it returns nil if the server can not listen, then the children run without navelcord.
+func (a *App) sharedNavelServer() *NavelServer {
+	a.navelOnce.Do(func() {
+		srv, err := NewNavelServer(a.conf.Navelcord, func(msg string) {
+			a.launcherLog(msg)
+			wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), msg+"\r\n")
+		})
+		if err != nil {
+			a.launcherLog("navelcord server: " + err.Error())
+			return
+		}
+		a.navel = srv
+	})
+	return a.navel
+}
+
 func (a *App) launcherLog(text string) {
 	if !a.enableLauncherLog {
 		return
@@ -249,17 +330,23 @@ func (a *App) launcherLog(text string) {
 	fd.WriteString(time.Now().Format("2006-01-02 15:04:05 ") + text + "\n")
 }
 
-func NewAppWriter(app *App, evtType EventType) io.Writer {
+func NewAppWriter(inst *Instance, evtType EventType) io.Writer {
 	return &AppWriter{
-		app:     app,
+		inst:    inst,
 		evtType: evtType,
+		lines:   &logLineSplitter{},
 	}
 }
 
 func (a *App) saveLaunchOptions() {
 	if !a.disableConfigPersistence {
-		json.MarshalIndent(a.conf, "", "  ")
-		content, err := json.MarshalIndent(a.conf, "", "  ")
+		// neocatLock is taken before confLock
+		neocat := a.neocatOptions()
+		a.confLock.RLock()
+		conf := a.conf
+		conf.NeoCatOptions = neocat
+		content, err := json.MarshalIndent(conf, "", "  ")
+		a.confLock.RUnlock()
 		if err != nil {
 			a.launcherLog(err.Error())
 		} else {
@@ -274,6 +361,7 @@ func (a *App) saveLaunchOptions() {
 }
 
 func (a *App) loadLaunchOptions() {
+	defer a.migrateProfiles()
 	if confDir, err := os.UserConfigDir(); err != nil {
 		a.launcherLog(err.Error())
 		a.disableConfigPersistence = true
@@ -289,6 +377,9 @@ func (a *App) loadLaunchOptions() {
 		a.configFilename = filepath.Join(confDir, "config.json")
 		if _, err := os.Stat(a.configFilename); err == nil {
 			if content, err := os.ReadFile(a.configFilename); err == nil {
+				// profiles are rebuilt by migrateProfiles, if the file is an old one
+				a.conf.Profiles, a.conf.ActiveProfile = nil, ""
+				a.conf.LaunchOptions = defaultLaunchOptions()
 				if err := json.Unmarshal(content, &a.conf); err != nil {
 					a.launcherLog("parse config error: " + err.Error())
 				} else {
@@ -306,7 +397,7 @@ func (a *App) DoRevealConfig() {
 }
 
 func (a *App) DoRevealNeoBin() {
-	a.revealFile(a.conf.LaunchOptions.BinPath)
+	a.revealFile(a.launchOptions().BinPath)
 }
 
 func (a *App) revealFile(path string) {
@@ -320,21 +411,25 @@ func (a *App) revealFile(path string) {
 	}
 }
 
-func (a *App) appendLog(p []byte) {
-	a.logBuffer.Write(p)
-	if a.logBuffer.Len() > a.logBufferLimit {
-		a.logBuffer.Next(a.logBuffer.Len() - a.logBufferLimit)
-	}
-}
-
+// AppWriter keeps the output of an instance, and shows it on the terminal if the instance is active
 type AppWriter struct {
-	app     *App
+	inst    *Instance
 	evtType EventType
+	lines   *logLineSplitter // every stream has its own, the lines of stdout and stderr do not interleave
 }
 
+// Write shows p on the terminal as is, and keeps the complete lines in the log of the instance.
+// The output of the server is parsed into the log records as well.
 func (w *AppWriter) Write(p []byte) (n int, err error) {
-	wailsRuntime.EventsEmit(w.app.ctx, string(w.evtType), string(p))
-	w.app.appendLog(p)
+	if w.inst.isActive() {
+		wailsRuntime.EventsEmit(w.inst.app.ctx, string(w.evtType), string(p))
+	}
+	if lines := w.lines.split(p); len(lines) > 0 {
+		w.inst.logLines.append(lines)
+		if w.evtType == EVT_TERM {
+			w.inst.records.add(lines)
+		}
+	}
 	return len(p), nil
 }
 
@@ -343,28 +438,33 @@ func (a *App) OnDomReady(ctx context.Context) {
 
 func (a *App) DoFrontendReady() {
 	a.naReady.Wait()
-	if a.na == nil {
+	if a.ctx == nil {
 		return
 	}
-	a.na.Open()
+	inst := a.activeInstance()
+	inst.emitState()
 
 	a.emitLaunchCmdWithFlags()
 
-	if a.logBuffer.Len() > 0 {
-		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), a.logBuffer.String())
+	if log := inst.logString(); log != "" {
+		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), log)
 	} else {
-		a.na.Version()
+		inst.agent.Version()
 	}
 }
 
 func (a *App) emitLaunchCmdWithFlags() {
 	v := a.makeLaunchFlags()
+	v.Errors = a.launchOptions().Validate()
 	wailsRuntime.EventsEmit(a.ctx, string(EVT_FLAGS), v)
 }
 
 type LaunchCmdWithFlags struct {
-	BinPath string   `json:"binPath"`
-	Flags   []string `json:"flags"`
+	BinPath string      `json:"binPath"`
+	Flags   []string    `json:"flags"`
+	Env     []string    `json:"env,omitempty"`   // KEY=VALUE overrides, expanded
+	Unset   []string    `json:"unset,omitempty"` // removed from the environment
+	Errors  []FlagError `json:"errors,omitempty"`
 }
 
 type ProcessInfo struct {
@@ -375,7 +475,7 @@ type ProcessInfo struct {
 func (a *App) DoGetProcessInfo() string {
 	ret := ProcessInfo{
 		OS:  runtime.GOOS,
-		PID: a.na.process.Pid,
+		PID: a.activeInstance().agent.Pid(),
 	}
 	out, _ := json.Marshal(ret)
 	result := string(out)
@@ -393,60 +493,183 @@ func (a *App) DoGetFlags() {
 	wailsRuntime.EventsEmit(a.ctx, string(EVT_FLAGS), strFlags)
 }
 
+// DoGetNeoCatLauncher returns a copy of the neocat options with the bin path and the pid of the running neocat
 func (a *App) DoGetNeoCatLauncher() *NeoCatOptions {
-	dir := filepath.Dir(a.conf.LaunchOptions.BinPath)
+	a.neocatLock.Lock()
+	defer a.neocatLock.Unlock()
+	ret := *a.conf.NeoCatOptions
+	ret.BinPath = a.neocatBinPath()
+	ret.Pid = 0
+	for _, nc := range a.neocatAgents {
+		if pid := nc.Pid(); pid != 0 {
+			ret.Pid = pid
+			break
+		}
+	}
+	return &ret
+}
+
+// neocatBinPath returns the neocat next to the machbase-neo executable, empty if not exists
+func (a *App) neocatBinPath() string {
+	dir := filepath.Dir(a.launchOptions().BinPath)
 	neocatExe := path.Join(dir, "neocat")
 	if runtime.GOOS == "windows" {
 		neocatExe += ".exe"
 	}
 	if _, err := os.Stat(neocatExe); err != nil {
-		a.conf.NeoCatOptions.BinPath = ""
-	} else {
-		a.conf.NeoCatOptions.BinPath = neocatExe
-	}
-	if a.neocatAgent == nil || a.neocatAgent.cmd == nil {
-		a.conf.NeoCatOptions.Pid = 0
+		return ""
 	}
+	return neocatExe
+}
+
+// neocatOptions returns the current neocat options, they are replaced as a whole and never modified in place
+func (a *App) neocatOptions() *NeoCatOptions {
+	a.neocatLock.Lock()
+	defer a.neocatLock.Unlock()
 	return a.conf.NeoCatOptions
 }
 
 func (a *App) DoSetNeoCatLauncher(opt *NeoCatOptions) {
-	// preserve current bin path
-	opt.BinPath = a.conf.NeoCatOptions.BinPath
-	opt.Pid = a.conf.NeoCatOptions.Pid
+	// not saved, DoGetNeoCatLauncher fills them
+	opt.BinPath, opt.Pid = "", 0
+	a.neocatLock.Lock()
 	a.conf.NeoCatOptions = opt
+	a.neocatLock.Unlock()
 }
 
 func (a *App) DoStartNeoCat() {
-	if a.na == nil {
-		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), "neocat can start only when machbase-neo is running\r\n")
+	inst := a.activeInstance()
+	if !inst.agent.IsReady() {
+		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), "neocat can start only when machbase-neo is ready\r\n")
 		return
 	}
-	a.DoStopNeoCat()
-	if a.neocatAgent == nil {
-		a.neocatAgent = &NeoCatAgent{navelcordEnabled: true}
-		if a.conf.LaunchOptions.Host != "" {
-			if a.conf.LaunchOptions.Host == "0.0.0.0" {
-				a.neocatAgent.host = "127.0.0.1:5653"
-			} else {
-				a.neocatAgent.host = fmt.Sprintf("%s:5653", a.conf.LaunchOptions.Host)
+	a.neocatLock.Lock()
+	defer a.neocatLock.Unlock()
+	a.neocatResume = false
+	if err := a.startNeoCat(inst); err != nil {
+		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), "neocat error "+err.Error()+"\r\n")
+	}
+}
+
+// DoCreateNeoCatTable creates the tag table that neocat writes into on the server of the active instance
+func (a *App) DoCreateNeoCatTable(table string) error {
+	inst := a.activeInstance()
+	if !inst.agent.IsReady() {
+		return errors.New("machbase-neo is not ready")
+	}
+	target := a.neocatTarget(inst, a.neocatOptions().Token)
+	if err := createTagTable(target, table); err != nil {
+		return err
+	}
+	return checkTagTable(target, table)
+}
+
+// DoGetNeoCatStatus returns the states of the neocat collectors, the instance of a status is the name of the collector
+func (a *App) DoGetNeoCatStatus() []NeoStatus {
+	a.neocatLock.Lock()
+	defer a.neocatLock.Unlock()
+	ret := []NeoStatus{}
+	for _, nc := range a.neocatAgents {
+		status := nc.Status()
+		status.Instance = nc.collector.Name
+		ret = append(ret, status)
+	}
+	return ret
+}
+
+func (a *App) DoStopNeoCat() {
+	a.neocatLock.Lock()
+	defer a.neocatLock.Unlock()
+	a.neocatResume = false
+	a.stopNeoCat()
+}
+
+// startNeoCat launches the neocat collectors that push to the server of the instance, the caller holds neocatLock
+func (a *App) startNeoCat(inst *Instance) error {
+	a.stopNeoCat()
+	opt := a.conf.NeoCatOptions
+	binPath := a.neocatBinPath()
+	if binPath == "" {
+		return errors.New("neocat not found next to machbase-neo")
+	}
+	collectors, err := opt.collectors()
+	if err != nil {
+		return err
+	}
+	target := a.neocatTarget(inst, opt.Token)
+	// neocat does not create the table, it drops every record if the table is not there
+	checked := map[string]bool{}
+	for _, c := range collectors {
+		table := strings.ToUpper(c.serverTable())
+		if table == "" || checked[table] {
+			continue
+		}
+		checked[table] = true
+		if err := checkTagTable(target, table); err != nil {
+			var lerr *LaunchError
+			if errors.As(err, &lerr) {
+				lerr.Instance = inst.name()
+				wailsRuntime.EventsEmit(a.ctx, string(EVT_ERROR), lerr)
 			}
+			return err
 		}
 	}
-	err := a.neocatAgent.Start(a.conf.NeoCatOptions, a.NewLogWriter())
-	if err != nil {
-		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), "neocat error "+err.Error()+"\r\n")
+	a.neocatFor = inst.name()
+	errs := []error{}
+	for _, c := range collectors {
+		nc := NewNeoCatAgent(c.Name, target, a.NewLogWriter(), func(status NeoStatus) {
+			status.Instance = c.Name
+			wailsRuntime.EventsEmit(a.ctx, string(EVT_NEOCAT), status)
+		})
+		a.neocatAgents = append(a.neocatAgents, nc)
+		if err := nc.Start(binPath, c); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	a.conf.NeoCatOptions.Pid = a.neocatAgent.cmd.Process.Pid
+	return errors.Join(errs...)
 }
 
-func (a *App) DoStopNeoCat() {
-	if a.neocatAgent == nil {
-		return
+// neocatTarget returns where neocat pushes the metrics to, the server of the instance
+func (a *App) neocatTarget(inst *Instance, token string) NeoCatTarget {
+	bind := inst.agent.bindAddress()
+	launch := inst.launchOptions()
+	target := NeoCatTarget{
+		Host:          bind.host,
+		Ports:         bind.ports,
+		MqttTls:       launch.MqttEnableTls,
+		MqttTokenAuth: launch.MqttEnableTokenAuth,
+		HttpTokenAuth: launch.HttpEnableTokenAuth,
+		Token:         token,
 	}
-	a.neocatAgent.Stop()
-	a.conf.NeoCatOptions.Pid = 0
-	a.neocatAgent = nil
+	if target.Host == "" || target.Host == "0.0.0.0" {
+		target.Host = "127.0.0.1"
+	}
+	return target
+}
+
+// stopNeoCat stops all collectors and waits until they exit, the caller holds neocatLock
+func (a *App) stopNeoCat() {
+	wg := sync.WaitGroup{}
+	for _, nc := range a.neocatAgents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nc.Stop()
+			nc.Close()
+		}()
+	}
+	wg.Wait()
+	a.neocatAgents = nil
+}
+
+// neocatRunning returns true if any collector is running, the caller holds neocatLock
+func (a *App) neocatRunning() bool {
+	for _, nc := range a.neocatAgents {
+		if nc.Pid() != 0 {
+			return true
+		}
+	}
+	return false
 }
 
 const historyLimit = 10
@@ -468,100 +691,142 @@ func addHistory(hist []string, item string) []string {
 }
 
 func (a *App) DoGetLaunchOptions() *LaunchOptions {
-	return a.conf.LaunchOptions
+	return a.launchOptions()
 }
 
 func (a *App) DoSetLaunchOptions(opts *LaunchOptions) {
 	if opts == nil {
 		return
 	}
+	a.confLock.Lock()
+	profile := a.activeProfile()
 	if opts.BinPath == "" {
 		// preserve current bin path
-		opts.BinPath = a.conf.LaunchOptions.BinPath
+		opts.BinPath = profile.LaunchOptions.BinPath
+	} else if opts.BinPath != profile.LaunchOptions.BinPath {
+		a.discoverFlags(opts.BinPath)
 	}
 	if path := opts.Data; path != "" {
-		a.conf.UI.RecentDirList = addHistory(a.conf.UI.RecentDirList, path)
+		profile.RecentDirList = addHistory(profile.RecentDirList, path)
 	}
 	if path := opts.File; path != "" {
-		a.conf.UI.RecentFileList = addHistory(a.conf.UI.RecentFileList, path)
+		profile.RecentFileList = addHistory(profile.RecentFileList, path)
 	}
-	a.conf.LaunchOptions = opts
+	profile.LaunchOptions = opts
+	a.confLock.Unlock()
 	a.saveLaunchOptions()
 	a.emitLaunchCmdWithFlags()
 }
 
 func (a *App) DoGetRecentDirList() []string {
-	return a.conf.UI.RecentDirList
+	a.confLock.RLock()
+	defer a.confLock.RUnlock()
+	return slices.Clone(a.activeProfile().RecentDirList)
 }
 
 func (a *App) DoGetRecentFileList() []string {
-	return a.conf.UI.RecentFileList
+	a.confLock.RLock()
+	defer a.confLock.RUnlock()
+	return slices.Clone(a.activeProfile().RecentFileList)
 }
 
 func (a *App) makeLaunchFlags() *LaunchCmdWithFlags {
-	ret := &LaunchCmdWithFlags{
-		BinPath: a.conf.LaunchOptions.BinPath,
-		Flags:   []string{},
-	}
+	return a.launchOptions().launchFlags()
+}
 
-	if a.conf.LaunchOptions.Data != "" {
-		ret.Flags = append(ret.Flags, "--data", a.conf.LaunchOptions.Data)
+// stopTimeout returns the grace period of each stage of stopping the server
+func (opts *LaunchOptions) stopTimeout() time.Duration {
+	if opts.StopTimeout == "" {
+		return defaultStopTimeout
 	}
-	if a.conf.LaunchOptions.File != "" {
-		ret.Flags = append(ret.Flags, "--file", a.conf.LaunchOptions.File)
-	}
-	if a.conf.LaunchOptions.BackupDir != "" {
-		ret.Flags = append(ret.Flags, "--backup-dir", a.conf.LaunchOptions.BackupDir)
-	}
-	if a.conf.LaunchOptions.Host != "" && a.conf.LaunchOptions.Host != "127.0.0.1" {
-		ret.Flags = append(ret.Flags, "--host", a.conf.LaunchOptions.Host)
+	d, err := time.ParseDuration(opts.StopTimeout)
+	if err != nil {
+		return defaultStopTimeout
 	}
-	if a.conf.LaunchOptions.LogLevel != "INFO" {
-		ret.Flags = append(ret.Flags, "--log-level", a.conf.LaunchOptions.LogLevel)
+	return d
+}
+
+func (opts *LaunchOptions) readyTimeout() time.Duration {
+	if opts.ReadyTimeout == "" {
+		return defaultReadyTimeout
 	}
-	if a.conf.LaunchOptions.LogFilename != "" && a.conf.LaunchOptions.LogFilename != "-" {
-		ret.Flags = append(ret.Flags, "--log-filename", a.conf.LaunchOptions.LogFilename)
+	d, err := time.ParseDuration(opts.ReadyTimeout)
+	if err != nil {
+		return defaultReadyTimeout
 	}
-	if a.conf.LaunchOptions.HttpDebug {
-		ret.Flags = append(ret.Flags, "--http-debug", "true")
+	return d
+}
+
+func (opts *LaunchOptions) healthInterval() time.Duration {
+	if opts.HealthInterval == "" {
+		return defaultHealthInterval
 	}
-	if a.conf.LaunchOptions.HttpEnableTokenAuth {
-		ret.Flags = append(ret.Flags, "--http-enable-token-auth", "true")
+	d, err := time.ParseDuration(opts.HealthInterval)
+	if err != nil {
+		return defaultHealthInterval
 	}
-	if a.conf.LaunchOptions.MqttEnableTokenAuth {
-		ret.Flags = append(ret.Flags, "--mqtt-enable-token-auth", "true")
+	return d
+}
+
+// watchdogOptions returns what to do when the server stops sending heartbeats
+func (opts *LaunchOptions) watchdogOptions() WatchdogOptions {
+	ret := WatchdogOptions{
+		MissLimit: opts.HeartbeatMissLimit,
+		Action:    WatchdogAction(opts.HeartbeatAction),
 	}
-	if a.conf.LaunchOptions.MqttEnableTls {
-		ret.Flags = append(ret.Flags, "--mqtt-enable-tls", "true")
+	if d, err := time.ParseDuration(opts.HeartbeatInterval); err == nil {
+		ret.Interval = d
 	}
-	if a.conf.LaunchOptions.JwtAtExpire != "" && a.conf.LaunchOptions.JwtAtExpire != "5m" {
-		ret.Flags = append(ret.Flags, "--jwt-at-expire", a.conf.LaunchOptions.JwtAtExpire)
+	return ret
+}
+
+// restartOptions returns the restart policy applied when the server exits unexpectedly
+func (opts *LaunchOptions) restartOptions() RestartOptions {
+	ret := RestartOptions{
+		Policy:     RestartPolicy(opts.RestartPolicy),
+		MaxRetries: opts.RestartMaxRetries,
 	}
-	if a.conf.LaunchOptions.JwtRtExpire != "" && a.conf.LaunchOptions.JwtRtExpire != "60m" && a.conf.LaunchOptions.JwtRtExpire != "1h" {
-		ret.Flags = append(ret.Flags, "--jwt-rt-expire", a.conf.LaunchOptions.JwtRtExpire)
+	if d, err := time.ParseDuration(opts.RestartBackoff); err == nil {
+		ret.Backoff = d
 	}
-	if a.conf.LaunchOptions.Experiment {
-		ret.Flags = append(ret.Flags, "--experiment", "true")
+	if d, err := time.ParseDuration(opts.RestartBackoffMax); err == nil {
+		ret.BackoffMax = d
 	}
 	return ret
 }
 
 func (a *App) DoOpenBrowser() {
-	wailsRuntime.BrowserOpenURL(a.ctx, "http://"+bestGuess.httpAddr)
+	agent := a.activeInstance().agent
+	if !agent.IsReady() {
+		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), "machbase-neo is not ready\r\n")
+		return
+	}
+	wailsRuntime.BrowserOpenURL(a.ctx, "http://"+agent.bindAddress().httpAddr)
 }
 
 var regexpAnsi = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))")
 
 func (a *App) DoCopyLog() {
-	text := regexpAnsi.ReplaceAllString(a.logBuffer.String(), "")
+	text := regexpAnsi.ReplaceAllString(a.activeInstance().logString(), "")
 	wailsRuntime.ClipboardSetText(a.ctx, text)
 }
 
 func (a *App) DoClearLog() {
-	a.logBuffer.Reset()
+	a.activeInstance().clearLog()
 	wailsRuntime.EventsEmit(a.ctx, string(EVT_TERM), `\033c`)
 }
 
+// DoGetLogLines returns at most limit lines of the log of the active instance from the sequence number from,
+// the latest lines if from is 0. The frontend pages back with from = First - limit.
+func (a *App) DoGetLogLines(from int64, limit int) LogPage {
+	return a.activeInstance().logLines.page(from, limit)
+}
+
+// DoQueryLog returns the log records of the active instance that match the filter
+func (a *App) DoQueryLog(filter LogFilter) []LogRecord {
+	return a.activeInstance().records.query(filter)
+}
+
 func (a *App) DoSaveLog() {
 	filename := fmt.Sprintf("machbase-neo-%s.txt", time.Now().Format("20060102-150405"))
 	path, err := wailsRuntime.SaveFileDialog(a.ctx, wailsRuntime.SaveDialogOptions{
@@ -577,7 +842,7 @@ func (a *App) DoSaveLog() {
 	if path == "" {
 		return
 	}
-	text := regexpAnsi.ReplaceAllString(a.logBuffer.String(), "")
+	text := regexpAnsi.ReplaceAllString(a.activeInstance().logString(), "")
 	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
 		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), err.Error())
 	}
@@ -597,15 +862,15 @@ func (a *App) DoSelectDirectory(org string) string {
 }
 
 func (a *App) DoStartServer() {
-	a.na.StartServer()
+	a.activeInstance().agent.StartServer()
 }
 
 func (a *App) DoStopServer() {
-	a.na.StopServer()
+	a.activeInstance().agent.StopServer()
 }
 
 func (a *App) DoVersion() {
-	a.na.Version()
+	a.activeInstance().agent.Version()
 }
 
 func (a *App) DoSetTheme(theme string) {
@@ -619,42 +884,52 @@ func (a *App) DoGetTheme() string {
 type guess struct {
 	httpAddr string
 	grpcAddr string
-}
 
-var bestGuess = guess{
-	httpAddr: "127.0.0.1:5654",
-	grpcAddr: "127.0.0.1:5655",
+	host  string            // the host that the server binds, e.g. 0.0.0.0
+	ports map[string]string // the listening ports keyed by the flag name, see listenPortFlags
 }
 
+// listenPortFlags are the flags of the ports that machbase-neo listens on
+var listenPortFlags = []string{"http-port", "grpc-port", "mqtt-port", "shell-port", "mach-port"}
+
+var defaultBindAddress = guessBindAddress(nil)
+
 func guessBindAddress(args []string) guess {
 	host := "127.0.0.1"
-	grpcPort := "5655"
-	httpPort := "5654"
+	ports := map[string]string{}
+	for _, name := range listenPortFlags {
+		if spec := builtinFlag(name); spec != nil {
+			ports[name] = spec.Default
+		}
+	}
 	for i := 0; i < len(args); i++ {
 		s := args[i]
-		if strings.HasPrefix(s, "--host=") {
-			host = s[7:]
-		} else if s == "--host" && len(args) > i+1 && !strings.HasPrefix(args[i+1], "-") {
-			host = args[i+1]
-			i++
-		} else if strings.HasPrefix(s, "--grpc-port=") {
-			grpcPort = s[12:]
-		} else if s == "--grpc-port" && len(args) > i+1 && !strings.HasPrefix(args[i+1], "-") {
-			grpcPort = args[i+1]
-			i++
-		} else if strings.HasPrefix(s, "--http-port=") {
-			httpPort = s[12:]
-		} else if s == "--http-port" && len(args) > i+1 && !strings.HasPrefix(args[i+1], "-") {
-			httpPort = args[i+1]
+		if !strings.HasPrefix(s, "--") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(s[2:], "=")
+		if !hasValue {
+			if len(args) <= i+1 || strings.HasPrefix(args[i+1], "-") {
+				continue
+			}
+			value = args[i+1]
 			i++
 		}
+		if name == "host" {
+			host = value
+		} else if _, ok := ports[name]; ok {
+			ports[name] = value
+		}
 	}
-	if host == "0.0.0.0" {
-		host = "127.0.0.1"
+	addrHost := host
+	if addrHost == "0.0.0.0" || addrHost == "" {
+		addrHost = "127.0.0.1"
 	}
 	return guess{
-		httpAddr: fmt.Sprintf("%s:%s", host, httpPort),
-		grpcAddr: fmt.Sprintf("%s:%s", host, grpcPort),
+		httpAddr: net.JoinHostPort(addrHost, ports["http-port"]),
+		grpcAddr: net.JoinHostPort(addrHost, ports["grpc-port"]),
+		host:     host,
+		ports:    ports,
 	}
 }
 
@@ -0,0 +1,225 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discovered serve flags of the machbase-neo binaries, keyed by the path of the binary
+var (
+	flagSchemas     = map[string]*discoveredSchema{}
+	flagSchemasLock sync.Mutex
+)
+
+type discoveredSchema struct {
+	Version string      `json:"version"`
+	Flags   []*FlagSpec `json:"flags"`
+}
+
+// flagSchemaOf returns the serve flags that the binary supports,
+// it returns the builtin serveFlags if the binary has not been discovered.
+func flagSchemaOf(binPath string) []*FlagSpec {
+	flagSchemasLock.Lock()
+	defer flagSchemasLock.Unlock()
+	if ds, ok := flagSchemas[binPath]; ok {
+		return ds.Flags
+	}
+	return serveFlags
+}
+
+// discoverFlagSchema runs 'machbase-neo serve --help' and caches the parsed flags in cacheDir per version
+func discoverFlagSchema(binPath string, cacheDir string) (*discoveredSchema, error) {
+	if binPath == "" {
+		return nil, os.ErrNotExist
+	}
+	version, err := runHelper(binPath, "version")
+	if err != nil {
+		return nil, err
+	}
+	ver := parseVersion(version)
+	if ver == "" {
+		// unknown version, use the modification time of the binary instead
+		if stat, err := os.Stat(binPath); err == nil {
+			ver = fmt.Sprintf("%d-%d", stat.Size(), stat.ModTime().Unix())
+		}
+	}
+
+	cacheFile := ""
+	if cacheDir != "" && ver != "" {
+		cacheFile = filepath.Join(cacheDir, "serve-flags-"+regexpUnsafeFileChars.ReplaceAllString(ver, "_")+".json")
+		if content, err := os.ReadFile(cacheFile); err == nil {
+			ds := &discoveredSchema{}
+			if err := json.Unmarshal(content, ds); err == nil && len(ds.Flags) > 0 {
+				setFlagSchema(binPath, ds)
+				return ds, nil
+			}
+		}
+	}
+
+	help, err := runHelper(binPath, "serve", "--help")
+	if err != nil {
+		return nil, err
+	}
+	flags := mergeFlagSchema(parseServeHelp(help))
+	if len(flags) == 0 {
+		return nil, fmt.Errorf("no flags found in 'serve --help' of %s", binPath)
+	}
+	ds := &discoveredSchema{Version: ver, Flags: flags}
+	if cacheFile != "" {
+		if content, err := json.MarshalIndent(ds, "", "  "); err == nil {
+			os.WriteFile(cacheFile, content, 0644)
+		}
+	}
+	setFlagSchema(binPath, ds)
+	return ds, nil
+}
+
+func setFlagSchema(binPath string, ds *discoveredSchema) {
+	flagSchemasLock.Lock()
+	flagSchemas[binPath] = ds
+	flagSchemasLock.Unlock()
+}
+
+// runHelper runs machbase-neo with the args and returns the output
+func runHelper(binPath string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binPath, args...)
+	sysProcAttr(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil && len(out) == 0 {
+		return "", err
+	}
+	// kong exits with 0 for --help, but some versions exit with non-zero
+	return string(out), nil
+}
+
+var regexpVersion = regexp.MustCompile(`v\d+\.\d+\.\d+[0-9A-Za-z.\-+]*`)
+var regexpUnsafeFileChars = regexp.MustCompile(`[^0-9A-Za-z.\-]`)
+
+func parseVersion(out string) string {
+	return regexpVersion.FindString(out)
+}
+
+// e.g.
+//
+//	-h, --help                        Show context-sensitive help.
+//	    --host="127.0.0.1"            listening network addr
+//	    --[no-]http-debug             enable http debug log
+//	    --log-level="INFO"            log level (TRACE|DEBUG|INFO|WARN|ERROR)
+//	    --data=STRING                 path to database, no default but the placeholder of the type
+//	    --shutdown-wait=5m            unquoted default
+var regexpHelpFlag = regexp.MustCompile(`^\s+(?:-\w,\s+)?--(\[no-\])?([a-z0-9][a-z0-9\-]*)(?:=("[^"]*"|\S+))?\s*(.*)$`)
+var regexpHelpEnum = regexp.MustCompile(`\(([A-Za-z0-9_\-]+(?:\|[A-Za-z0-9_\-]+)+)\)`)
+var regexpHelpPlaceholder = regexp.MustCompile(`^[A-Z][A-Z0-9_\-]*$`)
+
+// helpPlaceholderTypes are the placeholders that kong prints for the flags without default
+var helpPlaceholderTypes = map[string]FlagType{
+	"INT":      FlagInt,
+	"INT64":    FlagInt,
+	"UINT":     FlagInt,
+	"FLOAT":    FlagFloat,
+	"FLOAT64":  FlagFloat,
+	"DURATION": FlagDuration,
+	"BOOL":     FlagBool,
+}
+
+// parseServeHelp parses the flags in the output of 'machbase-neo serve --help'
+func parseServeHelp(help string) []*FlagSpec {
+	ret := []*FlagSpec{}
+	scanner := bufio.NewScanner(strings.NewReader(help))
+	for scanner.Scan() {
+		m := regexpHelpFlag.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		negatable, name, def, desc := m[1] != "", m[2], m[3], strings.TrimSpace(m[4])
+		if name == "help" || name == "version" {
+			continue
+		}
+		quoted := strings.HasPrefix(def, `"`)
+		def = strings.Trim(def, `"`)
+		placeholder := ""
+		if !quoted && regexpHelpPlaceholder.MatchString(def) {
+			placeholder, def = def, ""
+		}
+		spec := &FlagSpec{Name: name, Default: def, Description: desc, Type: FlagString}
+		switch {
+		case negatable || def == "true" || def == "false":
+			spec.Type = FlagBool
+		case regexpHelpEnum.MatchString(desc):
+			spec.Type = FlagEnum
+			spec.Enum = strings.Split(regexpHelpEnum.FindStringSubmatch(desc)[1], "|")
+		case strings.HasSuffix(name, "-port"):
+			spec.Type = FlagPort
+		case placeholder != "":
+			if typ, ok := helpPlaceholderTypes[placeholder]; ok {
+				spec.Type = typ
+			}
+		case !quoted && def != "":
+			if _, err := strconv.ParseInt(def, 10, 64); err == nil {
+				spec.Type = FlagInt
+			} else if _, err := strconv.ParseFloat(def, 64); err == nil {
+				spec.Type = FlagFloat
+			} else if _, err := time.ParseDuration(def); err == nil {
+				spec.Type = FlagDuration
+			}
+		case def != "":
+			if _, err := time.ParseDuration(def); err == nil {
+				spec.Type = FlagDuration
+			}
+		}
+		ret = append(ret, spec)
+	}
+	return ret
+}
+
+// mergeFlagSchema takes the well-known types of the builtin schema for the discovered flags.
+// The builtin flags that the binary does not have are dropped.
+func mergeFlagSchema(discovered []*FlagSpec) []*FlagSpec {
+	ret := make([]*FlagSpec, 0, len(discovered))
+	for _, d := range discovered {
+		builtin := builtinFlag(d.Name)
+		if builtin == nil {
+			ret = append(ret, d)
+			continue
+		}
+		merged := *builtin
+		if d.Default != "" {
+			merged.Default = d.Default
+		}
+		if d.Description != "" {
+			merged.Description = d.Description
+		}
+		if len(d.Enum) > 0 {
+			merged.Enum = d.Enum
+		}
+		ret = append(ret, &merged)
+	}
+	return ret
+}
+
+// discoverFlags discovers the serve flags of the binary in background and shows the result
+func (a *App) discoverFlags(binPath string) {
+	go func() {
+		ds, err := discoverFlagSchema(binPath, a.configDir())
+		if err != nil {
+			a.launcherLog("discover serve flags: " + err.Error())
+			return
+		}
+		a.launcherLog(fmt.Sprintf("discover serve flags: %s %d flags", ds.Version, len(ds.Flags)))
+		if a.ctx != nil && a.launchOptions().BinPath == binPath {
+			a.emitLaunchCmdWithFlags()
+		}
+	}()
+}
@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// envOverrides returns the expanded KEY=VALUE pairs and the keys to unset, both sorted by the key
+func (opts *LaunchOptions) envOverrides() (set []string, unset []string) {
+	keys := make([]string, 0, len(opts.Env))
+	for k := range opts.Env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if v := opts.Env[k]; v == nil {
+			unset = append(unset, k)
+		} else {
+			set = append(set, k+"="+expandEnv(*v))
+		}
+	}
+	return
+}
+
+var regexpEnvRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces only ${NAME} with the value of the environment variable, empty if it is not set.
+// The other '$' are kept as they are, e.g. in passwords and JDBC strings.
+func expandEnv(value string) string {
+	return regexpEnvRef.ReplaceAllStringFunc(value, func(ref string) string {
+		return os.Getenv(ref[2 : len(ref)-1])
+	})
+}
+
+func (opts *LaunchOptions) validateEnv() []FlagError {
+	ret := []FlagError{}
+	keys := make([]string, 0, len(opts.Env))
+	for k := range opts.Env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		switch {
+		case k == "" || strings.ContainsAny(k, "=\x00"):
+			ret = append(ret, FlagError{Flag: "env", Value: k, Message: "invalid name of environment variable"})
+		case envKeyEqual(k, NAVEL_ENV) || envKeyEqual(k, NAVEL_TOKEN_ENV):
+			ret = append(ret, FlagError{Flag: "env", Value: k, Message: "reserved by the launcher", Warning: true})
+		}
+	}
+	return ret
+}
+
+// environ applies the env overrides of the launch command to the base environment
+func (launch *LaunchCmdWithFlags) environ(base []string) []string {
+	ret := make([]string, 0, len(base)+len(launch.Env))
+	overridden := func(kv string) bool {
+		k, _, _ := strings.Cut(kv, "=")
+		if slices.ContainsFunc(launch.Unset, func(u string) bool { return envKeyEqual(k, u) }) {
+			return true
+		}
+		return slices.ContainsFunc(launch.Env, func(e string) bool {
+			ek, _, _ := strings.Cut(e, "=")
+			return envKeyEqual(k, ek)
+		})
+	}
+	for _, kv := range base {
+		if !overridden(kv) {
+			ret = append(ret, kv)
+		}
+	}
+	for _, kv := range launch.Env {
+		if k, _, _ := strings.Cut(kv, "="); !envKeyEqual(k, NAVEL_ENV) && !envKeyEqual(k, NAVEL_TOKEN_ENV) {
+			ret = append(ret, kv)
+		}
+	}
+	return ret
+}
+
+// envKeyEqual compares the names of environment variables, those are case-insensitive on Windows
+func envKeyEqual(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
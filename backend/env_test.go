@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("NEO_TEST_HOME", "/data/neo")
+	t.Setenv("NEO_TEST_EMPTY", "")
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"braces", "${NEO_TEST_HOME}/db", "/data/neo/db"},
+		{"twice", "${NEO_TEST_HOME}:${NEO_TEST_HOME}", "/data/neo:/data/neo"},
+		{"not set", "a${NEO_TEST_NOT_SET}b", "ab"},
+		{"empty", "a${NEO_TEST_EMPTY}b", "ab"},
+		{"bare name is literal", "$NEO_TEST_HOME/db", "$NEO_TEST_HOME/db"},
+		{"lone dollar", "pa$$w0rd$", "pa$$w0rd$"},
+		{"dollar before braces", "$${NEO_TEST_HOME}", "$/data/neo"},
+		{"jdbc", "jdbc:machbase://host:5656/db?pw=$ecret", "jdbc:machbase://host:5656/db?pw=$ecret"},
+		{"invalid name", "${1ABC} ${A-B} ${}", "${1ABC} ${A-B} ${}"},
+		{"unclosed", "${NEO_TEST_HOME", "${NEO_TEST_HOME"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandEnv(tt.value); got != tt.want {
+				t.Fatalf("expandEnv(%q) = %q, expected %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	t.Setenv("NEO_TEST_HOME", "/data/neo")
+	value := func(s string) *string { return &s }
+	opts := &LaunchOptions{Env: map[string]*string{
+		"B_PASSWORD": value("$ecret$"),
+		"A_DIR":      value("${NEO_TEST_HOME}/a"),
+		"C_UNSET":    nil,
+	}}
+	set, unset := opts.envOverrides()
+	if want := []string{"A_DIR=/data/neo/a", "B_PASSWORD=$ecret$"}; !slices.Equal(set, want) {
+		t.Fatalf("set %v, expected %v", set, want)
+	}
+	if want := []string{"C_UNSET"}; !slices.Equal(unset, want) {
+		t.Fatalf("unset %v, expected %v", unset, want)
+	}
+}
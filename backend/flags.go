@@ -0,0 +1,337 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FlagType string
+
+const (
+	FlagString   FlagType = "string"
+	FlagBool     FlagType = "bool"
+	FlagInt      FlagType = "int"
+	FlagFloat    FlagType = "float"
+	FlagPort     FlagType = "port"
+	FlagDuration FlagType = "duration"
+	FlagSize     FlagType = "size"
+	FlagDir      FlagType = "dir"
+	FlagPath     FlagType = "path"
+	FlagEnum     FlagType = "enum"
+)
+
+// FlagSpec describes a flag of 'machbase-neo serve'
+type FlagSpec struct {
+	Name        string   `json:"name"`
+	Type        FlagType `json:"type"`
+	Default     string   `json:"default,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Group       string   `json:"group,omitempty"`
+}
+
+// FlagError is the result of validating a flag value
+type FlagError struct {
+	Flag    string `json:"flag"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+	// Warning does not prevent launching the server, e.g. the flag is not supported by the binary
+	Warning bool `json:"warning,omitempty"`
+}
+
+func (fe FlagError) Error() string {
+	if fe.Warning {
+		return fmt.Sprintf("ignored --%s %q, %s", fe.Flag, fe.Value, fe.Message)
+	}
+	return fmt.Sprintf("invalid --%s %q, %s", fe.Flag, fe.Value, fe.Message)
+}
+
+// serveFlags is the flags of 'machbase-neo serve', in the order of the command line
+var serveFlags = []*FlagSpec{
+	{Name: "data", Type: FlagDir, Description: "path to the database directory", Group: "general"},
+	{Name: "file", Type: FlagDir, Description: "path to the directory of script files", Group: "general"},
+	{Name: "backup-dir", Type: FlagDir, Description: "path to the backup directory", Group: "general"},
+	{Name: "pref", Type: FlagDir, Description: "path to the preference directory", Group: "general"},
+	{Name: "host", Type: FlagString, Default: "127.0.0.1", Description: "listening network address", Group: "general"},
+	{Name: "pid", Type: FlagPath, Description: "path to the pid file", Group: "general"},
+	{Name: "experiment", Type: FlagBool, Default: "false", Description: "enable experiment features", Group: "general"},
+
+	{Name: "log-level", Type: FlagEnum, Default: "INFO", Enum: []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR"}, Description: "log level", Group: "log"},
+	{Name: "log-filename", Type: FlagPath, Default: "-", Description: "path to the log file, '-' for stdout", Group: "log"},
+	{Name: "log-append", Type: FlagBool, Default: "true", Description: "append to the existing log file", Group: "log"},
+	{Name: "log-rotate-schedule", Type: FlagString, Default: "@midnight", Description: "cron expression of the log rotation", Group: "log"},
+	{Name: "log-max-size", Type: FlagInt, Default: "10", Description: "max size of a log file in MB", Group: "log"},
+	{Name: "log-max-backups", Type: FlagInt, Default: "1", Description: "max number of the rotated log files", Group: "log"},
+	{Name: "log-max-age", Type: FlagInt, Default: "7", Description: "max days to retain the rotated log files", Group: "log"},
+	{Name: "log-compress", Type: FlagBool, Default: "false", Description: "compress the rotated log files", Group: "log"},
+	{Name: "log-time-utc", Type: FlagBool, Default: "false", Description: "use UTC time in logs", Group: "log"},
+
+	{Name: "http-port", Type: FlagPort, Default: "5654", Description: "HTTP listening port", Group: "http"},
+	{Name: "http-debug", Type: FlagBool, Default: "false", Description: "enable HTTP logs", Group: "http"},
+	{Name: "http-enable-web", Type: FlagBool, Default: "true", Description: "enable web UI", Group: "http"},
+	{Name: "http-enable-token-auth", Type: FlagBool, Default: "false", Description: "enable HTTP token authentication", Group: "http"},
+	{Name: "http-linger", Type: FlagInt, Default: "-1", Description: "HTTP socket linger, -1 for system default", Group: "http"},
+	{Name: "http-readbuf-size", Type: FlagInt, Default: "0", Description: "HTTP socket read buffer size", Group: "http"},
+	{Name: "http-writebuf-size", Type: FlagInt, Default: "0", Description: "HTTP socket write buffer size", Group: "http"},
+
+	{Name: "grpc-port", Type: FlagPort, Default: "5655", Description: "gRPC listening port", Group: "grpc"},
+	{Name: "grpc-sock", Type: FlagPath, Description: "gRPC unix domain socket", Group: "grpc"},
+	{Name: "grpc-insecure", Type: FlagBool, Default: "false", Description: "allow gRPC without TLS", Group: "grpc"},
+	{Name: "grpc-max-recv-msg-size", Type: FlagInt, Default: "4", Description: "gRPC max receive message size in MB", Group: "grpc"},
+	{Name: "grpc-max-send-msg-size", Type: FlagInt, Default: "4", Description: "gRPC max send message size in MB", Group: "grpc"},
+
+	{Name: "mqtt-port", Type: FlagPort, Default: "5653", Description: "MQTT listening port", Group: "mqtt"},
+	{Name: "mqtt-sock", Type: FlagPath, Description: "MQTT unix domain socket", Group: "mqtt"},
+	{Name: "mqtt-enable-token-auth", Type: FlagBool, Default: "false", Description: "enable MQTT token authentication", Group: "mqtt"},
+	{Name: "mqtt-enable-tls", Type: FlagBool, Default: "false", Description: "enable MQTT X.509 authentication", Group: "mqtt"},
+	{Name: "mqtt-enable-persistence", Type: FlagBool, Default: "false", Description: "enable MQTT session persistence", Group: "mqtt"},
+	{Name: "mqtt-max-message", Type: FlagSize, Default: "1MB", Description: "MQTT max message size", Group: "mqtt"},
+
+	{Name: "shell-port", Type: FlagPort, Default: "5652", Description: "SSH shell listening port", Group: "shell"},
+	{Name: "mach-port", Type: FlagPort, Default: "5656", Description: "machbase native listening port", Group: "shell"},
+
+	{Name: "jwt-at-expire", Type: FlagDuration, Default: "5m", Description: "JWT access token expiration", Group: "auth"},
+	{Name: "jwt-rt-expire", Type: FlagDuration, Default: "60m", Description: "JWT refresh token expiration", Group: "auth"},
+	{Name: "jwt-rt-random", Type: FlagBool, Default: "false", Description: "use random refresh token", Group: "auth"},
+
+	{Name: "max-open-conn", Type: FlagInt, Default: "-1", Description: "max open connections, -1 for unlimited", Group: "resource"},
+	{Name: "max-open-conn-factor", Type: FlagFloat, Default: "1.5", Description: "max open connections per CPU, when max-open-conn is -1", Group: "resource"},
+	{Name: "max-open-query", Type: FlagInt, Default: "-1", Description: "max open queries, -1 for unlimited", Group: "resource"},
+	{Name: "max-open-query-factor", Type: FlagFloat, Default: "1.5", Description: "max open queries per CPU, when max-open-query is -1", Group: "resource"},
+	{Name: "max-pool-size", Type: FlagInt, Default: "-1", Description: "max size of the connection pool, -1 for unlimited", Group: "resource"},
+}
+
+var regexpSize = regexp.MustCompile(`^(?i)\d+(\.\d+)?\s*([KMGT]i?B?|B)?$`)
+
+// Validate returns nil if the value is valid for the flag
+func (spec *FlagSpec) Validate(value string) *FlagError {
+	if value == "" {
+		return nil
+	}
+	fail := func(format string, args ...any) *FlagError {
+		return &FlagError{Flag: spec.Name, Value: value, Message: fmt.Sprintf(format, args...)}
+	}
+	switch spec.Type {
+	case FlagBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fail("not a boolean")
+		}
+	case FlagInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fail("not an integer")
+		}
+	case FlagFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fail("not a number")
+		}
+	case FlagPort:
+		if port, err := strconv.Atoi(value); err != nil || port < 0 || port > 65535 {
+			return fail("port should be 0 ~ 65535")
+		}
+	case FlagDuration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fail("not a duration, e.g. 30s, 5m, 1h")
+		}
+	case FlagSize:
+		if !regexpSize.MatchString(value) {
+			return fail("not a size, e.g. 512KB, 1MB")
+		}
+	case FlagEnum:
+		if !slices.ContainsFunc(spec.Enum, func(s string) bool { return strings.EqualFold(s, value) }) {
+			return fail("should be one of %s", strings.Join(spec.Enum, ", "))
+		}
+	case FlagDir:
+		if stat, err := os.Stat(value); err == nil && !stat.IsDir() {
+			return fail("not a directory")
+		}
+	case FlagPath:
+		if value == "-" {
+			return nil
+		}
+		if stat, err := os.Stat(filepath.Dir(value)); err != nil || !stat.IsDir() {
+			return fail("directory %q does not exist", filepath.Dir(value))
+		}
+	}
+	return nil
+}
+
+// isDefault returns true if the value is same with the default value of the flag
+func (spec *FlagSpec) isDefault(value string) bool {
+	if value == spec.Default {
+		return true
+	}
+	switch spec.Type {
+	case FlagBool:
+		v, err1 := strconv.ParseBool(value)
+		d, err2 := strconv.ParseBool(spec.Default)
+		if spec.Default == "" {
+			d, err2 = false, nil
+		}
+		return err1 == nil && err2 == nil && v == d
+	case FlagDuration:
+		v, err1 := time.ParseDuration(value)
+		d, err2 := time.ParseDuration(spec.Default)
+		return err1 == nil && err2 == nil && v == d
+	case FlagEnum:
+		return strings.EqualFold(value, spec.Default)
+	}
+	return false
+}
+
+// builtinFlag returns the flag of the builtin schema, or nil if not exists
+func builtinFlag(name string) *FlagSpec {
+	for _, spec := range serveFlags {
+		if spec.Name == name {
+			return spec
+		}
+	}
+	return nil
+}
+
+// flagValues returns the values of serve flags, the typed fields take precedence over Flags
+func (opts *LaunchOptions) flagValues() map[string]string {
+	ret := map[string]string{}
+	for k, v := range opts.Flags {
+		ret[k] = v
+	}
+	setString := func(name string, v string) {
+		if v != "" {
+			ret[name] = v
+		}
+	}
+	setBool := func(name string, v bool) {
+		if v {
+			ret[name] = "true"
+		}
+	}
+	setString("data", opts.Data)
+	setString("file", opts.File)
+	setString("backup-dir", opts.BackupDir)
+	setString("host", opts.Host)
+	setString("log-level", opts.LogLevel)
+	setString("log-filename", opts.LogFilename)
+	setBool("http-debug", opts.HttpDebug)
+	setBool("http-enable-token-auth", opts.HttpEnableTokenAuth)
+	setBool("mqtt-enable-token-auth", opts.MqttEnableTokenAuth)
+	setBool("mqtt-enable-tls", opts.MqttEnableTls)
+	setString("jwt-at-expire", opts.JwtAtExpire)
+	setString("jwt-rt-expire", opts.JwtRtExpire)
+	setBool("experiment", opts.Experiment)
+	return ret
+}
+
+func (opts *LaunchOptions) launchFlags() *LaunchCmdWithFlags {
+	ret := &LaunchCmdWithFlags{
+		BinPath: opts.BinPath,
+		Flags:   []string{},
+	}
+	values := opts.flagValues()
+	for _, spec := range flagSchemaOf(opts.BinPath) {
+		value, ok := values[spec.Name]
+		if !ok || value == "" || spec.isDefault(value) {
+			continue
+		}
+		ret.Flags = append(ret.Flags, "--"+spec.Name, value)
+	}
+	for _, arg := range opts.ExtraArgs {
+		if arg = strings.TrimSpace(arg); arg != "" {
+			ret.Flags = append(ret.Flags, arg)
+		}
+	}
+	ret.Env, ret.Unset = opts.envOverrides()
+	return ret
+}
+
+// Validate checks all flag values and the launcher settings of the options
+func (opts *LaunchOptions) Validate() []FlagError {
+	ret := []FlagError{}
+	schema := flagSchemaOf(opts.BinPath)
+	values := opts.flagValues()
+	for _, spec := range schema {
+		if err := spec.Validate(values[spec.Name]); err != nil {
+			ret = append(ret, *err)
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	// the typed fields are set from the launcher UI, e.g. --data,
+	// the server must not start silently without them on the default database
+	typed := *opts
+	typed.Flags = nil
+	typedValues := typed.flagValues()
+	for _, name := range names {
+		if !slices.ContainsFunc(schema, func(spec *FlagSpec) bool { return spec.Name == name }) {
+			if _, ok := typedValues[name]; ok {
+				ret = append(ret, FlagError{Flag: name, Value: values[name], Message: "not supported by this machbase-neo"})
+			} else {
+				ret = append(ret, FlagError{Flag: name, Value: values[name], Message: "unknown flag of this machbase-neo", Warning: true})
+			}
+		}
+	}
+	for _, arg := range opts.ExtraArgs {
+		arg = strings.TrimSpace(arg)
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		name, _, _ := strings.Cut(arg[2:], "=")
+		if value := values[name]; value != "" {
+			ret = append(ret, FlagError{Flag: name, Value: value, Message: "overridden by the extra argument " + arg, Warning: true})
+		}
+	}
+	ret = append(ret, opts.validateEnv()...)
+	launcherSettings := []*FlagSpec{
+		{Name: "stopTimeout", Type: FlagDuration},
+		{Name: "readyTimeout", Type: FlagDuration},
+		{Name: "healthInterval", Type: FlagDuration},
+		{Name: "heartbeatInterval", Type: FlagDuration},
+		{Name: "heartbeatAction", Type: FlagEnum, Enum: []string{string(WatchdogWarn), string(WatchdogKill), string(WatchdogRestart)}},
+		{Name: "restartBackoff", Type: FlagDuration},
+		{Name: "restartBackoffMax", Type: FlagDuration},
+		{Name: "restartPolicy", Type: FlagEnum, Enum: []string{string(RestartNever), string(RestartOnFailure), string(RestartAlways)}},
+	}
+	for i, value := range []string{opts.StopTimeout, opts.ReadyTimeout, opts.HealthInterval, opts.HeartbeatInterval, opts.HeartbeatAction, opts.RestartBackoff, opts.RestartBackoffMax, opts.RestartPolicy} {
+		if err := launcherSettings[i].Validate(value); err != nil {
+			ret = append(ret, *err)
+		}
+	}
+	return ret
+}
+
+// preflight refuses to launch the server with invalid options or with the ports in use,
+// and reports the ignored options.
+func (opts *LaunchOptions) preflight(warn func(string, ...any)) error {
+	lines := []string{}
+	for _, e := range opts.Validate() {
+		if e.Warning {
+			warn(e.Error())
+		} else {
+			lines = append(lines, e.Error())
+		}
+	}
+	if len(lines) > 0 {
+		return fmt.Errorf("can not start machbase-neo\n  %s", strings.Join(lines, "\n  "))
+	}
+	return checkListenPorts(opts.launchFlags())
+}
+
+// DoGetFlagSchema returns the flags of 'machbase-neo serve' of the active profile
+func (a *App) DoGetFlagSchema() []*FlagSpec {
+	return flagSchemaOf(a.launchOptions().BinPath)
+}
+
+// DoValidateLaunchOptions returns the invalid flags of the options
+func (a *App) DoValidateLaunchOptions(opts *LaunchOptions) []FlagError {
+	if opts == nil {
+		return nil
+	}
+	return opts.Validate()
+}
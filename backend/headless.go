@@ -0,0 +1,438 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var headlessCommands = []string{"start", "stop", "status", "logs"}
+
+const (
+	headlessPidFile    = "headless.pid"
+	headlessStatusFile = "headless.json"
+	headlessLogFile    = "headless.log"
+	headlessStopFile   = "headless.stop" // 'stop' creates it, the running 'start' stops the server when it appears
+)
+
+// headlessValueFlags are the flags that take the next argument as the value
+var headlessValueFlags = []string{"bin", "profile", "n"}
+
+// IsHeadless returns true if the launcher is invoked as command line tool,
+// e.g. 'neo-launcher --headless', 'neo-launcher start' or 'neo-launcher --bin <path> start'
+func IsHeadless(args []string) bool {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return i+1 < len(args) && slices.Contains(headlessCommands, args[i+1])
+		}
+		if !strings.HasPrefix(arg, "-") {
+			if slices.Contains(headlessCommands, arg) {
+				return true
+			}
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name == "headless" {
+			return true
+		}
+		if !hasValue && slices.Contains(headlessValueFlags, name) {
+			i++
+		}
+	}
+	return false
+}
+
+// RunHeadless runs the launcher without the GUI and returns the exit code.
+// The flags can be placed before or after the command.
+//
+//	neo-launcher [--headless] [--bin <path>] [--profile <name>] start
+//	neo-launcher stop
+//	neo-launcher status
+//	neo-launcher logs [-f] [-n <lines>]
+func RunHeadless(args []string) int {
+	global := flag.NewFlagSet("neo-launcher", flag.ContinueOnError)
+	global.Bool("headless", true, "run without GUI")
+	binPath := global.String("bin", "", "path to the machbase-neo executable file")
+	profile := global.String("profile", "", "name of the launch profile, default is the active profile")
+	follow := global.Bool("f", false, "logs: follow the log output")
+	lines := global.Int("n", 100, "logs: number of lines to show")
+	global.Usage = func() {
+		fmt.Fprintf(global.Output(), "Usage: neo-launcher [--headless] [--bin <path>] [--profile <name>] [%s] [-f] [-n <lines>]\n", strings.Join(headlessCommands, "|"))
+		global.PrintDefaults()
+	}
+	// flag stops at the first non-flag argument, parse the rest again after the command
+	commands := []string{}
+	rest := args
+	for {
+		if err := global.Parse(rest); err != nil {
+			return 2
+		}
+		if global.NArg() == 0 {
+			break
+		}
+		commands = append(commands, global.Arg(0))
+		rest = global.Args()[1:]
+	}
+	command := "start"
+	if len(commands) > 1 {
+		fmt.Fprintf(global.Output(), "too many commands %s\n", strings.Join(commands, " "))
+		global.Usage()
+		return 2
+	} else if len(commands) == 1 {
+		command = commands[0]
+	}
+
+	a := NewApp()
+	a.loadLaunchOptions()
+	if *profile != "" {
+		if a.findProfile(*profile) == nil {
+			fmt.Fprintf(os.Stderr, "profile %q not found\n", *profile)
+			return 1
+		}
+		a.headlessProfile = *profile
+	}
+	h := &headless{app: a, dir: a.configDir()}
+
+	switch command {
+	case "start":
+		return h.start(*binPath)
+	case "stop":
+		return h.stop()
+	case "status":
+		return h.status()
+	case "logs":
+		return h.logs(*lines, *follow)
+	default:
+		global.Usage()
+		return 2
+	}
+}
+
+type headless struct {
+	app *App
+	dir string
+}
+
+// HeadlessStatus is written into the status file while 'start' is running
+type HeadlessStatus struct {
+	Pid       int      `json:"pid"`
+	ServerPid int      `json:"serverPid,omitempty"`
+	State     NeoState `json:"state"`
+	Restarts  int      `json:"restarts,omitempty"`
+	LastExit  string   `json:"lastExit,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	Health    *Health  `json:"health,omitempty"`
+	HttpAddr  string   `json:"httpAddr,omitempty"`
+	BinPath   string   `json:"binPath"`
+	Flags     []string `json:"flags"`
+	Updated   string   `json:"updated"`
+}
+
+// configDir returns the directory of config.json, where the launcher keeps its files
+func (a *App) configDir() string {
+	if a.configFilename != "" {
+		return filepath.Dir(a.configFilename)
+	}
+	return os.TempDir()
+}
+
+func (h *headless) path(name string) string {
+	return filepath.Join(h.dir, name)
+}
+
+// runningPid returns the pid of the headless launcher that is currently running, or 0
+func (h *headless) runningPid() int {
+	content, err := os.ReadFile(h.path(headlessPidFile))
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || !processAlive(pid) {
+		return 0
+	}
+	return pid
+}
+
+func (h *headless) start(binPath string) int {
+	if pid := h.runningPid(); pid != 0 {
+		fmt.Fprintf(os.Stderr, "neo-launcher is already running (pid: %d)\n", pid)
+		return 1
+	}
+	if binPath == "" {
+		binPath = h.app.launchOptions().BinPath
+	}
+	binPath, err := getMachbaseNeoPath(binPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Can not find machbase-neo executable file, use --bin <path>")
+		return 1
+	}
+	if h.app.launchOptions().BinPath != binPath {
+		h.app.setBinPath(binPath)
+		h.app.saveLaunchOptions()
+	}
+	if _, err := discoverFlagSchema(binPath, h.dir); err != nil {
+		fmt.Fprintf(os.Stderr, "can not discover serve flags, %s\n", err.Error())
+	}
+
+	if err := os.WriteFile(h.path(headlessPidFile), []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	defer os.Remove(h.path(headlessPidFile))
+	defer os.Remove(h.path(headlessStatusFile))
+	os.Remove(h.path(headlessStopFile))
+	defer os.Remove(h.path(headlessStopFile))
+
+	logFile, err := os.Create(h.path(headlessLogFile))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	defer logFile.Close()
+	out := io.MultiWriter(os.Stdout, logFile)
+
+	navel, err := NewNavelServer(h.app.conf.Navelcord, func(msg string) { fmt.Fprintln(out, msg) })
+	if err != nil {
+		fmt.Fprintf(out, "navelcord server: %s\n", err.Error())
+	} else {
+		defer navel.Close()
+	}
+
+	var preflightErr error
+	var na *NeoAgent
+	na = newServerAgent(h.app.launchOptions, serverHooks{
+		stdout: out,
+		stderr: out,
+		log:    out,
+		navel:  navel,
+		onState: func(status NeoStatus) {
+			if status.Reason != "" {
+				fmt.Fprintf(out, "machbase-neo %s, %s\n", status.State, status.Reason)
+			} else {
+				fmt.Fprintf(out, "machbase-neo %s\n", status.State)
+			}
+			h.writeStatus(na, status)
+		},
+		onHealth: func(health Health) {
+			if health.Status != HealthUp {
+				fmt.Fprintf(out, "machbase-neo health %s, %s\n", health.Status, health.LastError)
+			}
+			h.writeStatus(na, na.Status())
+		},
+		onPreflight: func(err error) {
+			preflightErr = err
+		},
+	})
+	na.Open()
+	defer na.Close()
+
+	launch := h.app.makeLaunchFlags()
+	for _, k := range launch.Unset {
+		fmt.Fprintf(out, "unset %s\n", k)
+	}
+	for _, kv := range launch.Env {
+		fmt.Fprintf(out, "env %s\n", kv)
+	}
+	fmt.Fprintf(out, "%s serve %s\n", launch.BinPath, strings.Join(launch.Flags, " "))
+	na.StartServer()
+	if preflightErr != nil {
+		return 1
+	}
+	// the run is over when the server has exited and is not going to be restarted,
+	// the launcher must not exit before it, or the server is left behind
+	finished := make(chan struct{})
+	go func() {
+		na.Wait()
+		close(finished)
+	}()
+
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigC)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sigC:
+		case <-ticker.C:
+			if _, err := os.Stat(h.path(headlessStopFile)); err != nil {
+				continue
+			}
+			fmt.Fprintln(out, "stop requested")
+		case <-finished:
+			if status := na.Status(); status.State == NeoFailed || status.ExitCode != 0 {
+				return 1
+			}
+			return 0
+		}
+		na.StopServer()
+		<-finished
+		return 0
+	}
+}
+
+func (h *headless) writeStatus(na *NeoAgent, status NeoStatus) {
+	launch := h.app.makeLaunchFlags()
+	st := HeadlessStatus{
+		Pid:      os.Getpid(),
+		State:    status.State,
+		Restarts: status.Restarts,
+		LastExit: status.LastExit,
+		Reason:   status.Reason,
+		HttpAddr: na.bindAddress().httpAddr,
+		BinPath:  launch.BinPath,
+		Flags:    launch.Flags,
+		Updated:  time.Now().Format(time.RFC3339),
+	}
+	st.ServerPid = na.Pid()
+	if health := na.Health(); health.Status != "" {
+		st.Health = &health
+	}
+	content, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return
+	}
+	os.WriteFile(h.path(headlessStatusFile), content, 0644)
+}
+
+func (h *headless) stop() int {
+	pid := h.runningPid()
+	if pid == 0 {
+		fmt.Println("neo-launcher is not running")
+		return 0
+	}
+	// the stop file works on every platform, the signal only wakes the launcher up earlier
+	if err := os.WriteFile(h.path(headlessStopFile), []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	if proc, err := os.FindProcess(pid); err == nil {
+		if err := interruptProcess(proc); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+	// wait the launcher stops the server in stages
+	deadline := time.Now().Add(3*h.app.launchOptions().stopTimeout() + 5*time.Second)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			fmt.Println("neo-launcher stopped")
+			return 0
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	fmt.Fprintf(os.Stderr, "neo-launcher (pid: %d) did not stop\n", pid)
+	return 1
+}
+
+func (h *headless) status() int {
+	pid := h.runningPid()
+	if pid == 0 {
+		fmt.Println("state: " + string(NeoStopped))
+		return 3
+	}
+	content, err := os.ReadFile(h.path(headlessStatusFile))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	st := HeadlessStatus{}
+	if err := json.Unmarshal(content, &st); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	fmt.Printf("state: %s\n", st.State)
+	fmt.Printf("launcher pid: %d\n", st.Pid)
+	if st.ServerPid != 0 {
+		fmt.Printf("server pid: %d\n", st.ServerPid)
+	}
+	if st.HttpAddr != "" {
+		fmt.Printf("http: http://%s\n", st.HttpAddr)
+	}
+	if st.Restarts > 0 {
+		fmt.Printf("restarts: %d\n", st.Restarts)
+	}
+	if st.LastExit != "" {
+		fmt.Printf("last exit: %s\n", st.LastExit)
+	}
+	if st.Reason != "" {
+		fmt.Printf("reason: %s\n", st.Reason)
+	}
+	if st.Health != nil {
+		fmt.Printf("health: %s (http: %.1fms, grpc: %.1fms, checked: %s)\n",
+			st.Health.Status, st.Health.HttpMs, st.Health.GrpcMs, st.Health.CheckedAt)
+		if hb := st.Health.Heartbeat; hb != nil {
+			fmt.Printf("heartbeat: %d received, last %s, latency min/avg/max %.1f/%.1f/%.1fms, missed %d\n",
+				hb.Count, hb.LastAt, hb.MinMs, hb.AvgMs, hb.MaxMs, hb.Missed)
+		}
+		if st.Health.LastError != "" {
+			fmt.Printf("last error: %s (%s)\n", st.Health.LastError, st.Health.LastErrorAt)
+		}
+	}
+	fmt.Printf("command: %s serve %s\n", st.BinPath, strings.Join(st.Flags, " "))
+	if st.State != NeoRunning {
+		return 3
+	}
+	return 0
+}
+
+func (h *headless) logs(lines int, follow bool) int {
+	fd, err := os.Open(h.path(headlessLogFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintln(os.Stderr, "no logs")
+			return 1
+		}
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	defer fd.Close()
+
+	tail := []string{}
+	reader := bufio.NewReader(fd)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			tail = append(tail, line)
+			if len(tail) > lines {
+				tail = tail[1:]
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	for _, line := range tail {
+		fmt.Print(line)
+	}
+	if !follow {
+		return 0
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			fmt.Print(line)
+		}
+		if err == io.EOF {
+			if h.runningPid() == 0 {
+				return 0
+			}
+			time.Sleep(200 * time.Millisecond)
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+	}
+}
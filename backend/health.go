@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type HealthStatus string
+
+const (
+	HealthUp       HealthStatus = "up"
+	HealthDegraded HealthStatus = "degraded"
+	HealthDown     HealthStatus = "down"
+)
+
+// Health is the result of a health check of the running server, it is sent as EVT_HEALTH
+type Health struct {
+	Instance    string          `json:"instance,omitempty"`
+	Status      HealthStatus    `json:"status"`
+	HttpMs      float64         `json:"httpMs"`
+	HttpError   string          `json:"httpError,omitempty"`
+	GrpcMs      float64         `json:"grpcMs"`
+	GrpcError   string          `json:"grpcError,omitempty"`
+	Heartbeat   *HeartbeatStats `json:"heartbeat,omitempty"`
+	Metrics     map[string]any  `json:"metrics,omitempty"` // the last status pushed by the server over navelcord
+	LastError   string          `json:"lastError,omitempty"`
+	LastErrorAt string          `json:"lastErrorAt,omitempty"`
+	CheckedAt   string          `json:"checkedAt"`
+}
+
+const (
+	defaultHealthInterval = 5 * time.Second
+	// a probe that takes longer than this makes the server degraded
+	healthSlowResponse = 2 * time.Second
+)
+
+// WithHealthCallback sets the callback that receives the result of every health check
+func WithHealthCallback(cb func(Health)) Option {
+	return func(na *NeoAgent) {
+		na.healthCallback = cb
+	}
+}
+
+// WithHealthInterval sets the period of the health check while the server is running
+func WithHealthInterval(fn func() time.Duration) Option {
+	return func(na *NeoAgent) {
+		na.healthInterval = fn
+	}
+}
+
+// Health returns the result of the last health check
+func (na *NeoAgent) Health() Health {
+	na.statusLock.Lock()
+	defer na.statusLock.Unlock()
+	return na.health
+}
+
+// monitorHealth checks the server periodically until the process exits
+func (na *NeoAgent) monitorHealth(exitC <-chan struct{}) {
+	interval := defaultHealthInterval
+	if na.healthInterval != nil {
+		if d := na.healthInterval(); d > 0 {
+			interval = d
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exitC:
+			na.statusLock.Lock()
+			na.health = Health{}
+			na.statusLock.Unlock()
+			return
+		case <-ticker.C:
+			if na.Status().State != NeoRunning {
+				// being stopped
+				continue
+			}
+			h := na.checkHealth(min(interval, healthSlowResponse+time.Second))
+			if na.healthCallback != nil {
+				na.healthCallback(h)
+			}
+		}
+	}
+}
+
+func (na *NeoAgent) checkHealth(timeout time.Duration) Health {
+	addr := na.bindAddress()
+	watchdog := na.watchdogOptions()
+	h := Health{Status: HealthUp, CheckedAt: time.Now().Format(time.RFC3339)}
+	slow := false
+
+	client := &http.Client{Timeout: timeout}
+	tick := time.Now()
+	if rsp, err := client.Get("http://" + addr.httpAddr + "/web/api/check"); err != nil {
+		h.HttpError = err.Error()
+	} else {
+		rsp.Body.Close()
+		if rsp.StatusCode >= http.StatusInternalServerError {
+			h.HttpError = rsp.Status
+		}
+	}
+	h.HttpMs = millis(time.Since(tick))
+	slow = slow || time.Since(tick) > healthSlowResponse
+
+	tick = time.Now()
+	if conn, err := net.DialTimeout("tcp", addr.grpcAddr, timeout); err != nil {
+		h.GrpcError = err.Error()
+	} else {
+		conn.Close()
+	}
+	h.GrpcMs = millis(time.Since(tick))
+	slow = slow || time.Since(tick) > healthSlowResponse
+
+	errs := []string{}
+	if h.HttpError != "" {
+		errs = append(errs, "http "+h.HttpError)
+	}
+	if h.GrpcError != "" {
+		errs = append(errs, "grpc "+h.GrpcError)
+	}
+
+	na.statusLock.Lock()
+	defer na.statusLock.Unlock()
+	h.Metrics = na.serverMetrics
+	if h.Heartbeat = na.heartbeatStats(watchdog); h.Heartbeat != nil && h.Heartbeat.Missed >= watchdog.MissLimit {
+		errs = append(errs, fmt.Sprintf("no heartbeat since %s", h.Heartbeat.LastAt))
+	}
+	switch {
+	case h.HttpError != "" && h.GrpcError != "":
+		h.Status = HealthDown
+	case len(errs) > 0 || slow:
+		h.Status = HealthDegraded
+	}
+	if len(errs) > 0 {
+		na.health.LastError = strings.Join(errs, "; ")
+		na.health.LastErrorAt = h.CheckedAt
+	}
+	h.LastError, h.LastErrorAt = na.health.LastError, na.health.LastErrorAt
+	na.health = h
+	return h
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
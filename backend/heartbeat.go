@@ -0,0 +1,175 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+)
+
+type WatchdogAction string
+
+const (
+	WatchdogWarn    WatchdogAction = "warn"    // only warns
+	WatchdogKill    WatchdogAction = "kill"    // kills the hung server, then the restart policy applies
+	WatchdogRestart WatchdogAction = "restart" // stops the hung server in stages and starts it again
+)
+
+// WatchdogOptions decides when the server is considered hung and what to do with it.
+// Interval is the expected heartbeat interval, it is taken from the heartbeats if zero.
+type WatchdogOptions struct {
+	Interval  time.Duration
+	MissLimit int
+	Action    WatchdogAction
+}
+
+const (
+	defaultHeartbeatMissLimit = 3
+	// used until the interval is observed from two heartbeats
+	defaultHeartbeatInterval = 10 * time.Second
+)
+
+// HeartbeatStats is the statistics of navelcord heartbeats of the current launch.
+// The latency of a heartbeat is Ack - Timestamp, both are taken on the same host.
+type HeartbeatStats struct {
+	Count      int     `json:"count"`
+	Missed     int     `json:"missed"` // intervals missed since the last heartbeat
+	LastAt     string  `json:"lastAt,omitempty"`
+	IntervalMs float64 `json:"intervalMs"`
+	LastMs     float64 `json:"lastMs"`
+	MinMs      float64 `json:"minMs"`
+	MaxMs      float64 `json:"maxMs"`
+	AvgMs      float64 `json:"avgMs"`
+}
+
+type heartbeatTracker struct {
+	count    int
+	lastAt   time.Time
+	lastTs   int64
+	interval time.Duration // observed
+	last     time.Duration
+	min      time.Duration
+	max      time.Duration
+	sum      time.Duration
+	warned   bool // the current outage has been warned
+}
+
+// WithHeartbeatWatchdog sets the watchdog that detects the server stops sending heartbeats
+func WithHeartbeatWatchdog(fn func() WatchdogOptions) Option {
+	return func(na *NeoAgent) {
+		na.watchdog = fn
+	}
+}
+
+// heartbeatReceived records the heartbeat that has been acknowledged
+func (na *NeoAgent) heartbeatReceived(hb *Heartbeat) {
+	latency := max(time.Duration(hb.Ack-hb.Timestamp), 0)
+	na.statusLock.Lock()
+	defer na.statusLock.Unlock()
+	t := &na.heartbeat
+	if t.count > 0 && hb.Timestamp > t.lastTs {
+		t.interval = time.Duration(hb.Timestamp - t.lastTs)
+	}
+	if t.count == 0 || latency < t.min {
+		t.min = latency
+	}
+	t.max = max(t.max, latency)
+	t.count++
+	t.sum += latency
+	t.last = latency
+	t.lastAt = time.Unix(0, hb.Ack)
+	t.lastTs = hb.Timestamp
+	t.warned = false
+}
+
+func (na *NeoAgent) watchdogOptions() WatchdogOptions {
+	opts := WatchdogOptions{}
+	if na.watchdog != nil {
+		opts = na.watchdog()
+	}
+	if opts.MissLimit <= 0 {
+		opts.MissLimit = defaultHeartbeatMissLimit
+	}
+	if opts.Action == "" {
+		opts.Action = WatchdogWarn
+	}
+	return opts
+}
+
+// HeartbeatStats returns the statistics of the heartbeats, nil if the server has not sent any
+func (na *NeoAgent) HeartbeatStats() *HeartbeatStats {
+	opts := na.watchdogOptions()
+	na.statusLock.Lock()
+	defer na.statusLock.Unlock()
+	return na.heartbeatStats(opts)
+}
+
+func (na *NeoAgent) heartbeatStats(opts WatchdogOptions) *HeartbeatStats {
+	t := &na.heartbeat
+	if t.count == 0 {
+		return nil
+	}
+	interval := na.heartbeatInterval(opts)
+	return &HeartbeatStats{
+		Count:      t.count,
+		Missed:     int(time.Since(t.lastAt) / interval),
+		LastAt:     t.lastAt.Format(time.RFC3339),
+		IntervalMs: millis(interval),
+		LastMs:     millis(t.last),
+		MinMs:      millis(t.min),
+		MaxMs:      millis(t.max),
+		AvgMs:      millis(t.sum / time.Duration(t.count)),
+	}
+}
+
+func (na *NeoAgent) heartbeatInterval(opts WatchdogOptions) time.Duration {
+	switch {
+	case opts.Interval > 0:
+		return opts.Interval
+	case na.heartbeat.interval > 0:
+		return na.heartbeat.interval
+	default:
+		return defaultHeartbeatInterval
+	}
+}
+
+// watchHeartbeat checks the heartbeats every second until the process exits.
+// It starts after the first heartbeat, the server that does not speak navelcord is not watched.
+// It warns once when the heartbeats stop, then kills or restarts the hung server and returns.
+// With warn it keeps watching, logs when the heartbeats resume and warns again on the next outage.
+func (na *NeoAgent) watchHeartbeat(exitC <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	hung := false
+	for {
+		select {
+		case <-exitC:
+			return
+		case <-ticker.C:
+		}
+		opts := na.watchdogOptions()
+		na.statusLock.Lock()
+		stats := na.heartbeatStats(opts)
+		if stats == nil || na.state != NeoRunning || stats.Missed < opts.MissLimit || na.heartbeat.warned {
+			na.statusLock.Unlock()
+			if hung && stats != nil && stats.Missed < opts.MissLimit {
+				hung = false
+				na.log(fmt.Sprintf("Heartbeat resumed at %s", stats.LastAt))
+			}
+			continue
+		}
+		na.heartbeat.warned = true
+		na.statusLock.Unlock()
+
+		hung = true
+		na.log(fmt.Sprintf("No heartbeat since %s (%d intervals missed), the server may be hung", stats.LastAt, stats.Missed))
+		switch opts.Action {
+		case WatchdogKill:
+			na.log("Killing the hung server...")
+			na.Kill()
+			return
+		case WatchdogRestart:
+			na.log("Restarting the hung server...")
+			go na.Restart()
+			return
+		}
+	}
+}
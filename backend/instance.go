@@ -0,0 +1,219 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Instance is a machbase-neo server supervised by the launcher.
+// Every profile has its own instance, the id of an instance is the name of the profile.
+type Instance struct {
+	id    string // guarded by app.confLock, it follows the name of the renamed profile
+	app   *App
+	agent *NeoAgent
+
+	logLines *LogRing
+	records  *LogRecordStore
+}
+
+type InstanceInfo struct {
+	Id       string    `json:"id"`
+	Active   bool      `json:"active"`
+	Status   NeoStatus `json:"status"`
+	Ready    bool      `json:"ready"`
+	Pid      int       `json:"pid,omitempty"`
+	HttpAddr string    `json:"httpAddr,omitempty"`
+}
+
+// instance returns the instance of the profile, it creates a new one if not exists
+func (a *App) instance(id string) *Instance {
+	a.instancesLock.Lock()
+	defer a.instancesLock.Unlock()
+	if inst, ok := a.instances[id]; ok {
+		return inst
+	}
+	inst := &Instance{
+		id:       id,
+		app:      a,
+		logLines: NewLogRing(a.conf.UI.LogMaxLines, a.conf.UI.LogMaxBytes),
+		records:  NewLogRecordStore(defaultLogRecordCapacity),
+	}
+	inst.agent = newServerAgent(inst.launchOptions, serverHooks{
+		stdout: NewAppWriter(inst, EVT_TERM),
+		stderr: NewAppWriter(inst, EVT_TERM),
+		log:    NewAppWriter(inst, EVT_LOG),
+		navel:  a.sharedNavelServer(),
+		onState: func(status NeoStatus) {
+			status.Instance = inst.name()
+			wailsRuntime.EventsEmit(a.ctx, string(EVT_STATE), status)
+		},
+		onHealth: func(health Health) {
+			health.Instance = inst.name()
+			wailsRuntime.EventsEmit(a.ctx, string(EVT_HEALTH), health)
+		},
+		onPreflight: func(err error) {
+			var lerr *LaunchError
+			if errors.As(err, &lerr) {
+				lerr.Instance = inst.name()
+				wailsRuntime.EventsEmit(a.ctx, string(EVT_ERROR), lerr)
+			}
+		},
+	})
+	inst.agent.AddDependent(&neocatDependent{inst: inst})
+	inst.agent.Open()
+	a.instances[id] = inst
+	return inst
+}
+
+func (a *App) activeInstance() *Instance {
+	return a.instance(a.activeProfileName())
+}
+
+func (a *App) findInstance(id string) *Instance {
+	a.instancesLock.Lock()
+	defer a.instancesLock.Unlock()
+	return a.instances[id]
+}
+
+func (a *App) runningInstances() []*Instance {
+	a.instancesLock.Lock()
+	defer a.instancesLock.Unlock()
+	ret := []*Instance{}
+	for _, inst := range a.instances {
+		if inst.isRunning() {
+			ret = append(ret, inst)
+		}
+	}
+	return ret
+}
+
+// renameInstance follows the renamed profile, the caller holds confLock
+func (a *App) renameInstance(id string, newId string) {
+	a.instancesLock.Lock()
+	defer a.instancesLock.Unlock()
+	if inst, ok := a.instances[id]; ok {
+		delete(a.instances, id)
+		inst.id = newId
+		a.instances[newId] = inst
+	}
+}
+
+// removeInstance removes the instance of the deleted profile, it returns nil if there is no instance.
+// The caller closes the returned instance after releasing confLock,
+// the state callback of the agent takes confLock while Close waits for it.
+func (a *App) removeInstance(id string) (*Instance, error) {
+	a.instancesLock.Lock()
+	defer a.instancesLock.Unlock()
+	inst, ok := a.instances[id]
+	if !ok {
+		return nil, nil
+	}
+	if inst.isRunning() {
+		return nil, fmt.Errorf("server of the profile %q is running", id)
+	}
+	delete(a.instances, id)
+	return inst, nil
+}
+
+// launchOptions returns the launch options of the profile of the instance,
+// it is safe to call from the supervisor while the profile is being changed.
+func (inst *Instance) launchOptions() *LaunchOptions {
+	inst.app.confLock.RLock()
+	defer inst.app.confLock.RUnlock()
+	if p := inst.app.findProfile(inst.id); p != nil {
+		return p.LaunchOptions
+	}
+	return defaultLaunchOptions()
+}
+
+func (inst *Instance) name() string {
+	inst.app.confLock.RLock()
+	defer inst.app.confLock.RUnlock()
+	return inst.id
+}
+
+func (inst *Instance) isActive() bool {
+	inst.app.confLock.RLock()
+	defer inst.app.confLock.RUnlock()
+	return inst.app.conf.ActiveProfile == inst.id
+}
+
+func (inst *Instance) isRunning() bool {
+	return inst.agent.Pid() != 0 || inst.agent.Status().State == NeoRestarting
+}
+
+func (inst *Instance) isReady() bool {
+	return inst.agent.IsReady()
+}
+
+func (inst *Instance) emitState() {
+	status := inst.agent.Status()
+	status.Instance = inst.name()
+	wailsRuntime.EventsEmit(inst.app.ctx, string(EVT_STATE), status)
+}
+
+func (inst *Instance) logString() string {
+	return inst.logLines.String()
+}
+
+func (inst *Instance) clearLog() {
+	inst.logLines.clear()
+	inst.records.clear()
+}
+
+func (inst *Instance) info() InstanceInfo {
+	ret := InstanceInfo{
+		Id:     inst.name(),
+		Active: inst.isActive(),
+		Status: inst.agent.Status(),
+		Pid:    inst.agent.Pid(),
+		Ready:  inst.isReady(),
+	}
+	ret.Status.Instance = ret.Id
+	if ret.Pid != 0 {
+		ret.HttpAddr = inst.agent.bindAddress().httpAddr
+	}
+	return ret
+}
+
+// DoGetInstances returns the instances of all profiles
+func (a *App) DoGetInstances() []InstanceInfo {
+	active := a.activeProfileName()
+	ret := []InstanceInfo{}
+	for _, name := range a.DoGetProfiles() {
+		if inst := a.findInstance(name); inst != nil {
+			ret = append(ret, inst.info())
+		} else {
+			ret = append(ret, InstanceInfo{
+				Id:     name,
+				Active: name == active,
+				Status: NeoStatus{State: NeoStopped, Instance: name},
+			})
+		}
+	}
+	return ret
+}
+
+func (a *App) DoStartInstance(id string) error {
+	if !slices.Contains(a.DoGetProfiles(), id) {
+		return fmt.Errorf("profile %q not found", id)
+	}
+	inst := a.instance(id)
+	if inst.isRunning() {
+		return errors.New("server is already running")
+	}
+	inst.agent.StartServer()
+	return nil
+}
+
+func (a *App) DoStopInstance(id string) error {
+	inst := a.findInstance(id)
+	if inst == nil {
+		return fmt.Errorf("instance %q not found", id)
+	}
+	inst.agent.StopServer()
+	return nil
+}
@@ -0,0 +1,222 @@
+package backend
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogRecord is a line of the machbase-neo output parsed into the fields of its log format,
+// e.g. '2024/01/31 10:40:25.880 INFO  neosvr           started addr=127.0.0.1:5654'.
+// The lines that do not follow the format are kept with only Seq and Message.
+type LogRecord struct {
+	Seq     int64             `json:"seq"`
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level,omitempty"`
+	Logger  string            `json:"logger,omitempty"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"` // trailing key=value pairs of the message
+}
+
+// LogFilter selects the log records, the empty conditions match everything
+type LogFilter struct {
+	Level  string     `json:"level,omitempty"`  // the minimum level, e.g. WARN matches WARN, ERROR and above
+	Logger string     `json:"logger,omitempty"` // case-insensitive substring of the logger
+	Text   string     `json:"text,omitempty"`   // case-insensitive substring of the message or the fields
+	Since  *time.Time `json:"since,omitempty"`
+	Until  *time.Time `json:"until,omitempty"`
+	Limit  int        `json:"limit,omitempty"` // the number of the latest matching records, defaultLogQueryLimit if 0
+}
+
+const (
+	defaultLogRecordCapacity = 10000
+	defaultLogQueryLimit     = 1000
+)
+
+var logLevels = map[string]int{
+	"TRACE": 0,
+	"DEBUG": 1,
+	"INFO":  2,
+	"WARN":  3,
+	"ERROR": 4,
+	"FATAL": 5,
+	"PANIC": 6,
+}
+
+var (
+	regexpLogLine  = regexp.MustCompile(`^(\d{4}[/-]\d{2}[/-]\d{2}[ T]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?)\s+([A-Za-z]+)\s+(\S+)\s*(.*)$`)
+	regexpLogField = regexp.MustCompile(`\s+([A-Za-z_][\w.\-]*)=("(?:[^"\\]|\\.)*"|\S+)$`)
+)
+
+var logTimeLayouts = []string{
+	"2006/01/02 15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// parseLogLine parses a line of the output without the ANSI escape sequences
+func parseLogLine(line string) LogRecord {
+	m := regexpLogLine.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{Message: line}
+	}
+	level := strings.ToUpper(m[2])
+	if level == "WARNING" {
+		level = "WARN"
+	}
+	if _, ok := logLevels[level]; !ok {
+		return LogRecord{Message: line}
+	}
+	var ts time.Time
+	for _, layout := range logTimeLayouts {
+		if t, err := time.ParseInLocation(layout, m[1], time.Local); err == nil {
+			ts = t
+			break
+		}
+	}
+	if ts.IsZero() {
+		return LogRecord{Message: line}
+	}
+	rec := LogRecord{Time: ts, Level: level, Logger: m[3], Message: m[4]}
+	for {
+		f := regexpLogField.FindStringSubmatchIndex(rec.Message)
+		if f == nil {
+			break
+		}
+		if rec.Fields == nil {
+			rec.Fields = map[string]string{}
+		}
+		key, value := rec.Message[f[2]:f[3]], rec.Message[f[4]:f[5]]
+		if _, dup := rec.Fields[key]; !dup {
+			rec.Fields[key] = strings.Trim(value, `"`)
+		}
+		rec.Message = rec.Message[:f[0]]
+	}
+	return rec
+}
+
+// LogRecordStore keeps the latest log records of an instance
+type LogRecordStore struct {
+	lock     sync.Mutex
+	records  []LogRecord
+	seq      int64
+	capacity int
+}
+
+func NewLogRecordStore(capacity int) *LogRecordStore {
+	return &LogRecordStore{capacity: capacity}
+}
+
+// add parses the complete lines of the output and keeps them
+func (s *LogRecordStore) add(lines []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, line := range lines {
+		line = strings.TrimRight(regexpAnsi.ReplaceAllString(line, ""), "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rec := parseLogLine(line)
+		s.seq++
+		rec.Seq = s.seq
+		s.records = append(s.records, rec)
+	}
+	if len(s.records) > s.capacity {
+		s.records = s.records[len(s.records)-s.capacity:]
+	}
+}
+
+func (s *LogRecordStore) clear() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.records = nil
+}
+
+// query returns the latest records that match the filter in the order of the output
+func (s *LogRecordStore) query(filter LogFilter) []LogRecord {
+	minLevel := -1
+	if filter.Level != "" {
+		if lv, ok := logLevels[strings.ToUpper(filter.Level)]; ok {
+			minLevel = lv
+		}
+	}
+	logger := strings.ToLower(filter.Logger)
+	text := strings.ToLower(filter.Text)
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultLogQueryLimit
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := []LogRecord{}
+	for i := len(s.records) - 1; i >= 0 && len(ret) < limit; i-- {
+		rec := s.records[i]
+		if minLevel >= 0 {
+			if lv, ok := logLevels[rec.Level]; !ok || lv < minLevel {
+				continue
+			}
+		}
+		if logger != "" && !strings.Contains(strings.ToLower(rec.Logger), logger) {
+			continue
+		}
+		if filter.Since != nil && (rec.Time.IsZero() || rec.Time.Before(*filter.Since)) {
+			continue
+		}
+		if filter.Until != nil && (rec.Time.IsZero() || rec.Time.After(*filter.Until)) {
+			continue
+		}
+		if text != "" && !rec.contains(text) {
+			continue
+		}
+		ret = append(ret, rec)
+	}
+	// the latest first while scanning, turn it back to the order of the output
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret
+}
+
+func (rec *LogRecord) contains(text string) bool {
+	if strings.Contains(strings.ToLower(rec.Message), text) {
+		return true
+	}
+	for k, v := range rec.Fields {
+		if strings.Contains(strings.ToLower(k+"="+v), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// logLineSplitter cuts the output of a stream into lines, it keeps the incomplete last line until the next write.
+// The lines keep their terminator.
+type logLineSplitter struct {
+	lock    sync.Mutex
+	partial []byte
+}
+
+// maxLogLineLength cuts a line that never ends, e.g. a progress bar redrawn with '\r'
+const maxLogLineLength = 64 * 1024
+
+func (ls *logLineSplitter) split(p []byte) []string {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+	data := append(ls.partial, p...)
+	idx := bytes.LastIndexByte(data, '\n')
+	if idx < 0 {
+		if len(data) > maxLogLineLength {
+			ls.partial = nil
+			return []string{string(data)}
+		}
+		ls.partial = data
+		return nil
+	}
+	ls.partial = append([]byte{}, data[idx+1:]...)
+	lines := strings.SplitAfter(string(data[:idx+1]), "\n")
+	return lines[:len(lines)-1] // the empty string after the last terminator
+}
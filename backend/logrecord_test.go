@@ -0,0 +1,126 @@
+package backend
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogLineSplitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   [][]string // the lines of each write
+	}{
+		{"complete lines", []string{"a\nb\n"}, [][]string{{"a\n", "b\n"}}},
+		{"partial line across writes", []string{"ab", "c\nd", "e\n"}, [][]string{nil, {"abc\n"}, {"de\n"}}},
+		{"terminator alone", []string{"a", "\n", "\n"}, [][]string{nil, {"a\n"}, {"\n"}}},
+		{"crlf", []string{"a\r", "\nb\r\n"}, [][]string{nil, {"a\r\n", "b\r\n"}}},
+		{"escape sequence split", []string{"\x1b[3", "2mINFO\x1b[0m\n"}, [][]string{nil, {"\x1b[32mINFO\x1b[0m\n"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ls := &logLineSplitter{}
+			for i, w := range tt.writes {
+				if got := ls.split([]byte(w)); !slices.Equal(got, tt.want[i]) {
+					t.Fatalf("write %d %q, lines %q, expected %q", i, w, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLogLineSplitterMaxLength(t *testing.T) {
+	ls := &logLineSplitter{}
+	progress := strings.Repeat("\r50%", maxLogLineLength/4)
+	if got := ls.split([]byte(progress)); got != nil {
+		t.Fatalf("cut before the max length, %d lines", len(got))
+	}
+	if got := ls.split([]byte("\r100%")); len(got) != 1 || len(got[0]) != len(progress)+5 {
+		t.Fatalf("line over the max length is not cut, %d lines", len(got))
+	}
+	if got := ls.split([]byte("done\n")); !slices.Equal(got, []string{"done\n"}) {
+		t.Fatalf("after the cut %q", got)
+	}
+}
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want LogRecord
+	}{
+		{
+			"2024/01/31 10:40:25.880 INFO  neosvr           started addr=127.0.0.1:5654",
+			LogRecord{Time: time.Date(2024, 1, 31, 10, 40, 25, 880000000, time.Local), Level: "INFO", Logger: "neosvr", Message: "started", Fields: map[string]string{"addr": "127.0.0.1:5654"}},
+		},
+		{
+			`2024-01-31 10:40:25 warning http request failed path="/db/query" status=500`,
+			LogRecord{Time: time.Date(2024, 1, 31, 10, 40, 25, 0, time.Local), Level: "WARN", Logger: "http", Message: "request failed", Fields: map[string]string{"path": "/db/query", "status": "500"}},
+		},
+		{
+			"2024-01-31T10:40:25.5+09:00 ERROR mqtt closed",
+			LogRecord{Time: time.Date(2024, 1, 31, 10, 40, 25, 500000000, time.FixedZone("", 9*3600)), Level: "ERROR", Logger: "mqtt", Message: "closed"},
+		},
+		{
+			"2024/01/31 10:40:25 DEBUG neosvr retry n=1 n=2",
+			LogRecord{Time: time.Date(2024, 1, 31, 10, 40, 25, 0, time.Local), Level: "DEBUG", Logger: "neosvr", Message: "retry", Fields: map[string]string{"n": "2"}},
+		},
+		{"2024/01/31 10:40:25 HELLO neosvr unknown level", LogRecord{Message: "2024/01/31 10:40:25 HELLO neosvr unknown level"}},
+		{"2024/13/31 10:40:25 INFO neosvr invalid month", LogRecord{Message: "2024/13/31 10:40:25 INFO neosvr invalid month"}},
+		{"machbase-neo v8.0.0", LogRecord{Message: "machbase-neo v8.0.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := parseLogLine(tt.line)
+			if !got.Time.Equal(tt.want.Time) || got.Level != tt.want.Level || got.Logger != tt.want.Logger ||
+				got.Message != tt.want.Message || !maps.Equal(got.Fields, tt.want.Fields) {
+				t.Fatalf("record %+v, expected %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogRecordStoreQuery(t *testing.T) {
+	s := NewLogRecordStore(5)
+	s.add([]string{
+		"machbase-neo v8.0.0\n",
+		"2024/01/31 10:00:00.000 INFO  neosvr  started addr=127.0.0.1:5654\n",
+		"\x1b[33m2024/01/31 10:01:00.000 WARN  http    slow query\x1b[0m\r\n",
+		"\n",
+		"2024/01/31 10:02:00.000 ERROR mqtt    closed client=Neo-1\n",
+		"2024/01/31 10:03:00.000 DEBUG neosvr  tick\n",
+		"2024/01/31 10:04:00.000 INFO  http    request path=/db/query\n",
+	})
+	at := func(min int) *time.Time {
+		ts := time.Date(2024, 1, 31, 10, min, 0, 0, time.Local)
+		return &ts
+	}
+	tests := []struct {
+		name   string
+		filter LogFilter
+		want   []int64 // the sequence numbers
+	}{
+		{"all kept within the capacity", LogFilter{}, []int64{2, 3, 4, 5, 6}},
+		{"minimum level", LogFilter{Level: "warn"}, []int64{3, 4}},
+		{"unknown level matches all", LogFilter{Level: "LOUD"}, []int64{2, 3, 4, 5, 6}},
+		{"logger", LogFilter{Logger: "HTTP"}, []int64{3, 6}},
+		{"text in the message", LogFilter{Text: "Slow"}, []int64{3}},
+		{"text in the fields", LogFilter{Text: "client=neo"}, []int64{4}},
+		{"since and until", LogFilter{Since: at(1), Until: at(3)}, []int64{3, 4, 5}},
+		{"latest within the limit", LogFilter{Limit: 2}, []int64{5, 6}},
+		{"conditions together", LogFilter{Level: "INFO", Logger: "neosvr", Limit: 10}, []int64{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []int64{}
+			for _, rec := range s.query(tt.filter) {
+				got = append(got, rec.Seq)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("records %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package backend
+
+import (
+	"strings"
+	"sync"
+)
+
+// LogLine is a line of the output of an instance, Text keeps the line terminator
+type LogLine struct {
+	Seq  int64  `json:"seq"`
+	Text string `json:"text"`
+}
+
+// LogPage is a range of the lines, First and Last are the sequence numbers of the oldest and the latest lines kept.
+// Both are 0 if no line is kept.
+type LogPage struct {
+	Lines []LogLine `json:"lines"`
+	First int64     `json:"first"`
+	Last  int64     `json:"last"`
+}
+
+const (
+	defaultLogMaxLines = 5000
+	defaultLogMaxBytes = 128 * 1024
+)
+
+// LogRing keeps the latest lines of the output within the capacity in lines and bytes,
+// the oldest lines are dropped as a whole so that no line or escape sequence is cut in half.
+// The sequence numbers keep increasing across clear, a client can resume from the last line it has seen.
+type LogRing struct {
+	lock     sync.Mutex
+	lines    []LogLine // ring storage, the oldest line is at head
+	head     int
+	count    int
+	bytes    int
+	seq      int64
+	maxLines int
+	maxBytes int
+}
+
+func NewLogRing(maxLines int, maxBytes int) *LogRing {
+	if maxLines <= 0 {
+		maxLines = defaultLogMaxLines
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultLogMaxBytes
+	}
+	return &LogRing{
+		lines:    make([]LogLine, maxLines),
+		maxLines: maxLines,
+		maxBytes: maxBytes,
+	}
+}
+
+// append keeps the lines, it always keeps the latest line even if the line alone exceeds maxBytes
+func (r *LogRing) append(lines []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, text := range lines {
+		if r.count == r.maxLines {
+			r.dropOldest()
+		}
+		r.seq++
+		r.lines[(r.head+r.count)%r.maxLines] = LogLine{Seq: r.seq, Text: text}
+		r.count++
+		r.bytes += len(text)
+		for r.bytes > r.maxBytes && r.count > 1 {
+			r.dropOldest()
+		}
+	}
+}
+
+func (r *LogRing) dropOldest() {
+	r.bytes -= len(r.lines[r.head].Text)
+	r.lines[r.head] = LogLine{}
+	r.head = (r.head + 1) % r.maxLines
+	r.count--
+}
+
+func (r *LogRing) at(i int) LogLine {
+	return r.lines[(r.head+i)%r.maxLines]
+}
+
+func (r *LogRing) clear() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for r.count > 0 {
+		r.dropOldest()
+	}
+	r.head = 0
+}
+
+// String returns all lines kept
+func (r *LogRing) String() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	sb := strings.Builder{}
+	sb.Grow(r.bytes)
+	for i := 0; i < r.count; i++ {
+		sb.WriteString(r.at(i).Text)
+	}
+	return sb.String()
+}
+
+// page returns at most limit lines from the sequence number from,
+// the latest lines if from is 0 or less. The lines older than First are already dropped.
+func (r *LogRing) page(from int64, limit int) LogPage {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ret := LogPage{Lines: []LogLine{}}
+	if r.count == 0 {
+		return ret
+	}
+	ret.First, ret.Last = r.at(0).Seq, r.at(r.count-1).Seq
+	if limit <= 0 || limit > r.count {
+		limit = r.count
+	}
+	start := 0
+	if from <= 0 {
+		start = r.count - limit
+	} else if from > ret.First {
+		start = int(min(from-ret.First, int64(r.count)))
+	}
+	for i := start; i < r.count && len(ret.Lines) < limit; i++ {
+		ret.Lines = append(ret.Lines, r.at(i))
+	}
+	return ret
+}
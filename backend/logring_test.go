@@ -0,0 +1,104 @@
+package backend
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func logRingLines(from, to int) []string {
+	ret := []string{}
+	for i := from; i <= to; i++ {
+		ret = append(ret, fmt.Sprintf("line %d\n", i))
+	}
+	return ret
+}
+
+func logPageSeqs(p LogPage) []int64 {
+	ret := []int64{}
+	for _, l := range p.Lines {
+		ret = append(ret, l.Seq)
+	}
+	return ret
+}
+
+func TestLogRingPage(t *testing.T) {
+	// 8 lines into 5 slots, the storage wraps around and the lines 1-3 are dropped
+	r := NewLogRing(5, 1024)
+	r.append(logRingLines(1, 3))
+	r.append(logRingLines(4, 8))
+	tests := []struct {
+		name  string
+		from  int64
+		limit int
+		want  []int64
+	}{
+		{"latest", 0, 0, []int64{4, 5, 6, 7, 8}},
+		{"latest within the limit", 0, 2, []int64{7, 8}},
+		{"over the count", -1, 100, []int64{4, 5, 6, 7, 8}},
+		{"from the first", 4, 0, []int64{4, 5, 6, 7, 8}},
+		{"from a dropped line", 2, 3, []int64{4, 5, 6}},
+		{"from the middle", 6, 0, []int64{6, 7, 8}},
+		{"from the middle within the limit", 5, 2, []int64{5, 6}},
+		{"from the last", 8, 0, []int64{8}},
+		{"after the last", 9, 0, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := r.page(tt.from, tt.limit)
+			if got := logPageSeqs(p); !slices.Equal(got, tt.want) {
+				t.Fatalf("lines %v, expected %v", got, tt.want)
+			}
+			if p.First != 4 || p.Last != 8 {
+				t.Fatalf("first %d last %d", p.First, p.Last)
+			}
+			for _, l := range p.Lines {
+				if l.Text != fmt.Sprintf("line %d\n", l.Seq) {
+					t.Fatalf("line %d is %q", l.Seq, l.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestLogRingCapacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxLines int
+		maxBytes int
+		lines    []string
+		want     string
+	}{
+		{"lines", 2, 1024, []string{"a\n", "b\n", "c\n"}, "b\nc\n"},
+		{"bytes", 10, 6, []string{"aa\n", "bb\n", "cc\n"}, "bb\ncc\n"},
+		{"oldest lines as a whole", 10, 8, []string{"a\n", "bbbbb\n", "c\n"}, "bbbbb\nc\n"},
+		{"latest line over the bytes", 10, 4, []string{"a\n", "bbbbbbbb\n"}, "bbbbbbbb\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewLogRing(tt.maxLines, tt.maxBytes)
+			r.append(tt.lines)
+			if got := r.String(); got != tt.want {
+				t.Fatalf("kept %q, expected %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogRingClear(t *testing.T) {
+	r := NewLogRing(3, 1024)
+	if p := r.page(0, 0); len(p.Lines) != 0 || p.First != 0 || p.Last != 0 {
+		t.Fatalf("page of the empty ring %+v", p)
+	}
+	r.append(logRingLines(1, 5))
+	r.clear()
+	if p := r.page(0, 0); len(p.Lines) != 0 || p.First != 0 || p.Last != 0 || r.String() != "" {
+		t.Fatalf("page after clear %+v", p)
+	}
+	// the sequence numbers keep increasing across clear
+	r.append(logRingLines(6, 7))
+	p := r.page(4, 0)
+	if got := logPageSeqs(p); !slices.Equal(got, []int64{6, 7}) || p.First != 6 || p.Last != 7 {
+		t.Fatalf("page after clear and append %+v", p)
+	}
+}
@@ -0,0 +1,149 @@
+package backend
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// NAVEL_MAX_FRAME is the default limit of the body size of a navelcord frame
+const NAVEL_MAX_FRAME = 1 << 20
+
+const navelHeaderSize = 6 // STX(1) TYPE(1) LENGTH(4)
+
+// NavelProtocolError is returned when the peer breaks the framing, the stream can not be recovered
+type NavelProtocolError struct {
+	Reason string
+}
+
+func (e *NavelProtocolError) Error() string {
+	return "navelcord protocol violation, " + e.Reason
+}
+
+// NavelFrameSizeError is returned for a frame that exceeds the maximum frame size
+type NavelFrameSizeError struct {
+	Type byte
+	Size uint32
+	Max  uint32
+}
+
+func (e *NavelFrameSizeError) Error() string {
+	return fmt.Sprintf("navelcord frame too large, type %d size %d exceeds %d", e.Type, e.Size, e.Max)
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// NavelReader decodes the frames of navelcord, STX(1) TYPE(1) LENGTH(4) BODY(LENGTH).
+//
+// ReadFrame returns io.EOF if the stream ends between frames, io.ErrUnexpectedEOF if it ends in a frame,
+// *NavelProtocolError for a broken frame and *NavelFrameSizeError for an oversized one.
+// If the underlying reader supports SetReadDeadline, e.g. net.Conn, Timeout limits reading a frame.
+type NavelReader struct {
+	r            io.Reader
+	MaxFrameSize uint32
+	Timeout      time.Duration
+	hdr          [navelHeaderSize]byte
+}
+
+func NewNavelReader(r io.Reader) *NavelReader {
+	return &NavelReader{r: r, MaxFrameSize: NAVEL_MAX_FRAME}
+}
+
+func (nr *NavelReader) ReadFrame() (byte, []byte, error) {
+	if d, ok := nr.r.(readDeadliner); ok && nr.Timeout > 0 {
+		d.SetReadDeadline(time.Now().Add(nr.Timeout))
+		defer d.SetReadDeadline(time.Time{})
+	}
+	if _, err := io.ReadFull(nr.r, nr.hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	if nr.hdr[0] != NAVEL_STX {
+		return 0, nil, &NavelProtocolError{Reason: fmt.Sprintf("invalid stx 0x%02X", nr.hdr[0])}
+	}
+	typ := nr.hdr[1]
+	size := binary.BigEndian.Uint32(nr.hdr[2:])
+	if size > nr.MaxFrameSize {
+		return 0, nil, &NavelFrameSizeError{Type: typ, Size: size, Max: nr.MaxFrameSize}
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(nr.r, body); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
+
+// ReadMessage reads the next known message, the frames of unknown types are skipped
+func (nr *NavelReader) ReadMessage() (NavelMessage, error) {
+	for {
+		typ, body, err := nr.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := navelMessages[typ]; !ok {
+			continue
+		}
+		return decodeNavelMessage(typ, body)
+	}
+}
+
+// decodeNavelMessage decodes the body of a frame of the known type
+func decodeNavelMessage(typ byte, body []byte) (NavelMessage, error) {
+	msg := navelMessages[typ]()
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, &NavelProtocolError{Reason: fmt.Sprintf("invalid body of type %d, %s", typ, err.Error())}
+	}
+	return msg, nil
+}
+
+// NavelWriter encodes the frames of navelcord, it is safe for concurrent use.
+// If the underlying writer supports SetWriteDeadline, Timeout limits writing a frame.
+type NavelWriter struct {
+	w            io.Writer
+	MaxFrameSize uint32
+	Timeout      time.Duration
+	lock         sync.Mutex
+}
+
+func NewNavelWriter(w io.Writer) *NavelWriter {
+	return &NavelWriter{w: w, MaxFrameSize: NAVEL_MAX_FRAME}
+}
+
+func (nw *NavelWriter) WriteFrame(typ byte, body []byte) error {
+	if uint64(len(body)) > uint64(nw.MaxFrameSize) {
+		return &NavelFrameSizeError{Type: typ, Size: uint32(min(uint64(len(body)), 1<<32-1)), Max: nw.MaxFrameSize}
+	}
+	pkt := make([]byte, navelHeaderSize+len(body))
+	pkt[0], pkt[1] = NAVEL_STX, typ
+	binary.BigEndian.PutUint32(pkt[2:], uint32(len(body)))
+	copy(pkt[navelHeaderSize:], body)
+
+	nw.lock.Lock()
+	defer nw.lock.Unlock()
+	if d, ok := nw.w.(writeDeadliner); ok && nw.Timeout > 0 {
+		d.SetWriteDeadline(time.Now().Add(nw.Timeout))
+		defer d.SetWriteDeadline(time.Time{})
+	}
+	_, err := nw.w.Write(pkt)
+	return err
+}
+
+func (nw *NavelWriter) WriteMessage(msg NavelMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return nw.WriteFrame(msg.NavelType(), body)
+}
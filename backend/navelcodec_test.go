@@ -0,0 +1,164 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func navelFrame(typ byte, body []byte) []byte {
+	pkt := make([]byte, navelHeaderSize+len(body))
+	pkt[0], pkt[1] = NAVEL_STX, typ
+	binary.BigEndian.PutUint32(pkt[2:], uint32(len(body)))
+	copy(pkt[navelHeaderSize:], body)
+	return pkt
+}
+
+func navelHeader(typ byte, size uint32) []byte {
+	hdr := []byte{NAVEL_STX, typ, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(hdr[2:], size)
+	return hdr
+}
+
+func TestNavelReaderErrors(t *testing.T) {
+	heartbeat := navelFrame(NAVEL_HEARTBEAT, []byte(`{"ts":1}`))
+	tests := []struct {
+		name  string
+		input []byte
+		check func(error) bool
+	}{
+		{"empty stream", nil, func(err error) bool { return err == io.EOF }},
+		{"partial header", heartbeat[:3], func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) }},
+		{"partial body", heartbeat[:len(heartbeat)-2], func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) }},
+		{"header without body", heartbeat[:navelHeaderSize], func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) }},
+		{"invalid stx", append([]byte{0x00}, heartbeat[1:]...), func(err error) bool {
+			var perr *NavelProtocolError
+			return errors.As(err, &perr)
+		}},
+		{"oversized frame", navelHeader(NAVEL_HEARTBEAT, NAVEL_MAX_FRAME+1), func(err error) bool {
+			var serr *NavelFrameSizeError
+			return errors.As(err, &serr) && serr.Size == NAVEL_MAX_FRAME+1 && serr.Max == NAVEL_MAX_FRAME
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := NewNavelReader(bytes.NewReader(tt.input)).ReadFrame()
+			if !tt.check(err) {
+				t.Fatalf("unexpected error %T %v", err, err)
+			}
+		})
+	}
+}
+
+func TestNavelReaderMaxFrameSize(t *testing.T) {
+	body := bytes.Repeat([]byte{'x'}, NAVEL_MAX_FRAME)
+	typ, got, err := NewNavelReader(bytes.NewReader(navelFrame(99, body))).ReadFrame()
+	if err != nil || typ != 99 || len(got) != NAVEL_MAX_FRAME {
+		t.Fatalf("frame of the max size, type %d len %d err %v", typ, len(got), err)
+	}
+}
+
+func TestNavelReaderShortReads(t *testing.T) {
+	stream := append(navelFrame(NAVEL_HEARTBEAT, []byte(`{"ts":1}`)), navelFrame(NAVEL_LOG, []byte(`{"ts":2,"msg":"hello"}`))...)
+	nr := NewNavelReader(iotest.OneByteReader(bytes.NewReader(stream)))
+	msg, err := nr.ReadMessage()
+	if hb, ok := msg.(*Heartbeat); err != nil || !ok || hb.Timestamp != 1 {
+		t.Fatalf("first message %#v %v", msg, err)
+	}
+	msg, err = nr.ReadMessage()
+	if log, ok := msg.(*NavelLog); err != nil || !ok || log.Message != "hello" {
+		t.Fatalf("second message %#v %v", msg, err)
+	}
+	if _, err := nr.ReadMessage(); err != io.EOF {
+		t.Fatalf("end of stream %v", err)
+	}
+}
+
+func TestNavelReaderMessages(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		check func(NavelMessage, error) bool
+	}{
+		{"unknown type skipped", append(navelFrame(200, []byte("anything")), navelFrame(NAVEL_READY, []byte(`{}`))...),
+			func(msg NavelMessage, err error) bool {
+				_, ok := msg.(*NavelReady)
+				return err == nil && ok
+			}},
+		{"invalid json", navelFrame(NAVEL_HEARTBEAT, []byte(`{"ts":`)), func(msg NavelMessage, err error) bool {
+			var perr *NavelProtocolError
+			return errors.As(err, &perr)
+		}},
+		{"unknown type then eof", navelFrame(200, nil), func(msg NavelMessage, err error) bool { return err == io.EOF }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := NewNavelReader(bytes.NewReader(tt.input)).ReadMessage()
+			if !tt.check(msg, err) {
+				t.Fatalf("unexpected result %#v %T %v", msg, err, err)
+			}
+		})
+	}
+}
+
+func TestNavelWriterRoundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	nw := NewNavelWriter(buf)
+	if err := nw.WriteMessage(&NavelHello{Version: NAVEL_VERSION, Token: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nw.WriteFrame(NAVEL_LOG, make([]byte, NAVEL_MAX_FRAME+1)); err == nil {
+		t.Fatal("oversized frame is written")
+	}
+	msg, err := NewNavelReader(buf).ReadMessage()
+	if hello, ok := msg.(*NavelHello); err != nil || !ok || hello.Token != "t" || hello.Version != NAVEL_VERSION {
+		t.Fatalf("round trip %#v %v", msg, err)
+	}
+}
+
+func FuzzNavelReader(f *testing.F) {
+	f.Add(navelFrame(NAVEL_HEARTBEAT, []byte(`{"ts":1}`)))
+	f.Add(navelFrame(NAVEL_HELLO, []byte(`{"version":1,"token":"x"}`)))
+	f.Add(navelFrame(200, []byte("unknown")))
+	f.Add(navelHeader(NAVEL_LOG, NAVEL_MAX_FRAME+1))
+	f.Add([]byte{NAVEL_STX})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		nr := NewNavelReader(bytes.NewReader(data))
+		nr.MaxFrameSize = 4096
+		for i := 0; ; i++ {
+			typ, body, err := nr.ReadFrame()
+			if err != nil {
+				var perr *NavelProtocolError
+				var serr *NavelFrameSizeError
+				if err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.As(err, &perr) && !errors.As(err, &serr) {
+					t.Fatalf("untyped error %T %v", err, err)
+				}
+				break
+			}
+			if uint32(len(body)) > nr.MaxFrameSize {
+				t.Fatalf("frame type %d of %d bytes exceeds the limit", typ, len(body))
+			}
+			if i > len(data) {
+				t.Fatal("more frames than bytes")
+			}
+		}
+
+		nr = NewNavelReader(bytes.NewReader(data))
+		nr.MaxFrameSize = 4096
+		for {
+			msg, err := nr.ReadMessage()
+			if err != nil {
+				break
+			}
+			if msg == nil {
+				t.Fatal("nil message without error")
+			}
+			if _, ok := navelMessages[msg.NavelType()]; !ok {
+				t.Fatalf("unregistered message type %d", msg.NavelType())
+			}
+		}
+	})
+}
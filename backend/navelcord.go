@@ -0,0 +1,145 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// NAVEL_ENV tells the child where to connect, the port on loopback or the path of the unix domain socket
+const NAVEL_ENV = "NEOSHELL_NAVELCORD"
+
+// NAVEL_TOKEN_ENV carries the secret that the child has to send in the hello, it is generated per launch
+const NAVEL_TOKEN_ENV = "NEOSHELL_NAVELCORD_TOKEN"
+const NAVEL_STX = 0x4E
+
+// message types of navelcord
+const (
+	NAVEL_HEARTBEAT = 1 // server -> launcher, launcher replies with Ack
+	NAVEL_READY     = 2 // server -> launcher, the server is ready to serve
+	NAVEL_HELLO     = 3 // both ways, the handshake with the token, negotiates the protocol version
+	NAVEL_SHUTDOWN  = 4 // launcher -> server, asks the server to shutdown
+	NAVEL_STATUS    = 5 // server -> launcher, status and metrics of the server
+	NAVEL_LOG       = 6 // server -> launcher, forwarded log message
+)
+
+// navelHandshakeTimeout limits how long a new connection can take to send the first frame
+const navelHandshakeTimeout = 5 * time.Second
+
+// navelWriteTimeout limits writing a message to the peer that does not read
+const navelWriteTimeout = 5 * time.Second
+
+// NAVEL_VERSION is the latest protocol version of navelcord that the launcher speaks.
+// A server that does not send hello speaks version 0, which has only heartbeat,
+// it is accepted only in the legacy mode of the profile, see NavelChild.AllowLegacy.
+const NAVEL_VERSION = 1
+
+// NavelMessage is a message of navelcord, the body of a frame is the message in JSON
+type NavelMessage interface {
+	NavelType() byte
+}
+
+// navelMessages is the registry of the known message types
+var navelMessages = map[byte]func() NavelMessage{
+	NAVEL_HEARTBEAT: func() NavelMessage { return &Heartbeat{} },
+	NAVEL_READY:     func() NavelMessage { return &NavelReady{} },
+	NAVEL_HELLO:     func() NavelMessage { return &NavelHello{} },
+	NAVEL_SHUTDOWN:  func() NavelMessage { return &NavelShutdown{} },
+	NAVEL_STATUS:    func() NavelMessage { return &NavelStatus{} },
+	NAVEL_LOG:       func() NavelMessage { return &NavelLog{} },
+}
+
+type Heartbeat struct {
+	Timestamp int64 `json:"ts"`
+	Ack       int64 `json:"ack,omitempty"`
+}
+
+type NavelReady struct {
+	HttpAddr string `json:"httpAddr,omitempty"`
+	GrpcAddr string `json:"grpcAddr,omitempty"`
+}
+
+type NavelHello struct {
+	Version int    `json:"version"`
+	Name    string `json:"name,omitempty"`
+	Release string `json:"release,omitempty"` // e.g. v8.0.29
+	Pid     int    `json:"pid,omitempty"`
+	Token   string `json:"token,omitempty"` // child -> launcher only
+}
+
+type NavelShutdown struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type NavelStatus struct {
+	Timestamp int64          `json:"ts"`
+	Metrics   map[string]any `json:"metrics,omitempty"`
+}
+
+type NavelLog struct {
+	Timestamp int64  `json:"ts"`
+	Level     string `json:"level,omitempty"`
+	Message   string `json:"msg"`
+}
+
+func (*Heartbeat) NavelType() byte     { return NAVEL_HEARTBEAT }
+func (*NavelReady) NavelType() byte    { return NAVEL_READY }
+func (*NavelHello) NavelType() byte    { return NAVEL_HELLO }
+func (*NavelShutdown) NavelType() byte { return NAVEL_SHUTDOWN }
+func (*NavelStatus) NavelType() byte   { return NAVEL_STATUS }
+func (*NavelLog) NavelType() byte      { return NAVEL_LOG }
+
+func (hb *Heartbeat) Marshal() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := NewNavelWriter(buf).WriteMessage(hb); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (hb *Heartbeat) Unmarshal(r io.Reader) error {
+	typ, body, err := NewNavelReader(r).ReadFrame()
+	if err != nil {
+		return err
+	}
+	if typ != NAVEL_HEARTBEAT {
+		return &NavelProtocolError{Reason: fmt.Sprintf("type %d is not heartbeat", typ)}
+	}
+	if err := json.Unmarshal(body, hb); err != nil {
+		return &NavelProtocolError{Reason: "invalid heartbeat, " + err.Error()}
+	}
+	return nil
+}
+
+// handleNavelMessage handles a message from the server, the connection is closed if it returns error.
+// The heartbeat has the ack already, ManagedProcess sends it back.
+func (na *NeoAgent) handleNavelMessage(msg NavelMessage) error {
+	switch m := msg.(type) {
+	case *Heartbeat:
+		na.heartbeatReceived(m)
+	case *NavelStatus:
+		na.statusLock.Lock()
+		na.serverMetrics = m.Metrics
+		na.statusLock.Unlock()
+	case *NavelLog:
+		if na.stdoutWriter != nil {
+			fmt.Fprintf(na.stdoutWriter, "%s %s %s\r\n",
+				time.Unix(0, m.Timestamp).Format("2006-01-02 15:04:05.000"), m.Level, m.Message)
+		}
+	}
+	return nil
+}
+
+func newNavelToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// never happens, but do not allow an empty token
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,389 @@
+package backend
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NavelServer is the navelcord endpoint of the launcher that the supervised children connect to.
+// Every child registers to the server and gets its own token for each launch,
+// the server tells the connections apart by the token in the hello.
+type NavelServer struct {
+	lsnr     net.Listener
+	addr     string // the value of NAVEL_ENV, the port of tcp or the path of the unix domain socket
+	cleanup  func()
+	log      func(string)
+	lock     sync.Mutex
+	children map[string]*NavelChild
+	seq      int
+	wg       sync.WaitGroup
+}
+
+// NavelHandler receives the events of the connection of a child, every callback is optional
+type NavelHandler struct {
+	// OnConnect is called when the child is authenticated
+	OnConnect func(hello *NavelHello, version int)
+	// OnMessage is called for every message except hello, the connection is closed if it returns error
+	OnMessage func(msg NavelMessage) error
+	// OnDisconnect is called when the connection is closed, err is nil if it is closed normally
+	OnDisconnect func(err error)
+	// Log receives the messages about the connection of the child
+	Log func(string)
+}
+
+// NavelChild is a registration of a supervised child to the NavelServer
+type NavelChild struct {
+	id      string
+	server  *NavelServer
+	handler NavelHandler
+	// guarded by server.lock
+	token   string
+	conn    net.Conn
+	writer  *NavelWriter
+	version int
+	// the pid of the launch that may connect without hello, see AllowLegacy
+	legacyPid int
+}
+
+// NavelTransport is the kind of the listener of the navelcord server
+type NavelTransport string
+
+const (
+	// NavelTransportTCP listens on a loopback port, it is the default
+	NavelTransportTCP NavelTransport = "tcp"
+	// NavelTransportUnix listens on a unix domain socket that only the user can access,
+	// it falls back to tcp on the platform that does not support it.
+	NavelTransportUnix NavelTransport = "unix"
+)
+
+// NewNavelServer listens on the transport, log receives the messages about rejected connections
+func NewNavelServer(transport NavelTransport, log func(string)) (*NavelServer, error) {
+	s := &NavelServer{
+		log:      log,
+		children: map[string]*NavelChild{},
+	}
+	if transport == NavelTransportUnix {
+		lsnr, path, cleanup, err := listenNavelUnix()
+		if err == nil {
+			s.lsnr, s.addr, s.cleanup = lsnr, path, cleanup
+		} else {
+			s.logf("navelcord falls back to tcp, %s", err.Error())
+		}
+	}
+	if s.lsnr == nil {
+		lsnr, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		s.lsnr, s.addr = lsnr, strconv.Itoa(lsnr.Addr().(*net.TCPAddr).Port)
+	}
+	lsnr := s.lsnr
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := lsnr.Accept()
+			if err != nil {
+				// when the server is closed
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s, nil
+}
+
+// Close stops listening and closes all connections
+func (s *NavelServer) Close() {
+	s.lsnr.Close()
+	s.lock.Lock()
+	for _, c := range s.children {
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	}
+	s.children = map[string]*NavelChild{}
+	s.lock.Unlock()
+	s.wg.Wait()
+	if s.cleanup != nil {
+		s.cleanup()
+	}
+}
+
+// verifiesPeer returns true if the server can tell the pid of the peer of a connection
+func (s *NavelServer) verifiesPeer() bool {
+	_, ok := s.lsnr.(*net.UnixListener)
+	return ok && navelPeerPidSupported
+}
+
+// Addr returns where the children connect to, the port of tcp or the path of the unix domain socket
+func (s *NavelServer) Addr() string {
+	return s.addr
+}
+
+// Register adds a child, the name is only for identifying the child in logs
+func (s *NavelServer) Register(name string, h NavelHandler) *NavelChild {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.seq++
+	c := &NavelChild{
+		id:      fmt.Sprintf("%s#%d", name, s.seq),
+		server:  s,
+		handler: h,
+	}
+	s.children[c.id] = c
+	return c
+}
+
+func (s *NavelServer) logf(format string, args ...any) {
+	if s.log != nil {
+		s.log(fmt.Sprintf(format, args...))
+	}
+}
+
+// serve authenticates the connection, then handles the messages until the connection is closed
+func (s *NavelServer) serve(conn net.Conn) {
+	defer conn.Close()
+	nr := NewNavelReader(conn)
+	deadline := time.Now().Add(navelHandshakeTimeout)
+	first, err := readNavelFirst(conn, nr, deadline)
+	if err != nil {
+		s.logf("navelcord rejected %s, %s", navelPeer(conn), err.Error())
+		return
+	}
+	hello, _ := first.(*NavelHello)
+	var c *NavelChild
+	if hello != nil {
+		c, err = s.attach(conn, hello)
+	} else {
+		c, err = s.attachLegacy(conn, deadline)
+	}
+	if err != nil {
+		s.logf("navelcord rejected %s, %s", navelPeer(conn), err.Error())
+		return
+	}
+	defer s.detach(c, conn)
+
+	if hello != nil {
+		c.logf("navelcord connected %s %s (protocol version: %d)", hello.Name, hello.Release, c.Version())
+		if err := c.Send(&NavelHello{Version: c.Version(), Name: "neo-launcher"}); err != nil {
+			return
+		}
+		first = nil
+	}
+	if c.handler.OnConnect != nil {
+		c.handler.OnConnect(hello, c.Version())
+	}
+	err = c.dispatch(first, nr, hello == nil)
+	if c.handler.OnDisconnect != nil {
+		c.handler.OnDisconnect(err)
+	}
+}
+
+// dispatch passes the messages to the handler until the connection is closed,
+// the legacy connection passes only heartbeat that is all of version 0.
+func (c *NavelChild) dispatch(msg NavelMessage, nr *NavelReader, legacy bool) error {
+	for {
+		if _, ok := msg.(*Heartbeat); legacy && !ok {
+			msg = nil
+		}
+		if msg != nil && c.handler.OnMessage != nil {
+			if err := c.handler.OnMessage(msg); err != nil {
+				return err
+			}
+		}
+		var err error
+		msg, err = nr.ReadMessage()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			c.logf("navelcord closed, %s", err.Error())
+			return err
+		}
+		if _, ok := msg.(*NavelHello); ok {
+			msg = nil
+		}
+	}
+}
+
+// attach binds the connection to the child that owns the token of the hello.
+// A child can have only one connection at a time.
+func (s *NavelServer) attach(conn net.Conn, hello *NavelHello) (*NavelChild, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var found *NavelChild
+	for _, c := range s.children {
+		if c.token == "" || subtle.ConstantTimeCompare([]byte(c.token), []byte(hello.Token)) != 1 {
+			continue
+		}
+		if c.conn != nil {
+			return nil, fmt.Errorf("%s is already connected", c.id)
+		}
+		found = c
+		break
+	}
+	if found == nil {
+		return nil, errors.New("invalid token")
+	}
+	found.bind(conn)
+	found.version = max(min(hello.Version, NAVEL_VERSION), 0)
+	return found, nil
+}
+
+// attachLegacy binds the connection without hello to the child that allows it for the launch,
+// only if the peer of the connection is the launched process.
+// The peer can connect before the launcher knows the pid, it is retried until the handshake deadline.
+func (s *NavelServer) attachLegacy(conn net.Conn, deadline time.Time) (*NavelChild, error) {
+	pid, err := navelPeerPid(conn)
+	if err != nil {
+		return nil, fmt.Errorf("expected hello, the peer of the connection without token can not be verified, %w", err)
+	}
+	for {
+		s.lock.Lock()
+		for _, c := range s.children {
+			if c.legacyPid != 0 && c.legacyPid == pid && c.conn == nil {
+				c.bind(conn)
+				c.version = 0
+				s.lock.Unlock()
+				c.logf("navelcord accepted pid %d in legacy mode", pid)
+				return c, nil
+			}
+		}
+		s.lock.Unlock()
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("expected hello, pid %d is not allowed to connect without token", pid)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// bind makes the connection of the child, the caller holds server.lock
+func (c *NavelChild) bind(conn net.Conn) {
+	c.conn = conn
+	c.writer = NewNavelWriter(conn)
+	c.writer.Timeout = navelWriteTimeout
+}
+
+func (s *NavelServer) detach(c *NavelChild, conn net.Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if c.conn == conn {
+		c.conn, c.writer, c.version = nil, nil, 0
+	}
+}
+
+// Env renews the token of the child and returns the environment variables for the new launch,
+// the new launch has to send the hello with the token unless AllowLegacy is called for it.
+func (c *NavelChild) Env() []string {
+	token := newNavelToken()
+	c.server.lock.Lock()
+	c.token = token
+	c.legacyPid = 0
+	c.server.lock.Unlock()
+	return []string{
+		fmt.Sprintf("%s=%s", NAVEL_ENV, c.server.addr),
+		fmt.Sprintf("%s=%s", NAVEL_TOKEN_ENV, token),
+	}
+}
+
+// AllowLegacy lets the launched process of the pid connect without hello, for the releases of machbase-neo
+// that speak only version 0 and exit when the navelcord is rejected. It is the explicit choice of the user,
+// the connection is accepted only if the server can verify that the peer is the process of the pid,
+// that is on the unix domain socket of linux and darwin.
+func (c *NavelChild) AllowLegacy(pid int) {
+	if !c.server.verifiesPeer() {
+		c.logf("navelcord legacy mode needs the unix transport to verify the peer, the connection without token is rejected")
+		return
+	}
+	c.server.lock.Lock()
+	c.legacyPid = pid
+	c.server.lock.Unlock()
+	c.logf("navelcord legacy mode, pid %d may connect without token", pid)
+}
+
+// Send writes the message to the child
+func (c *NavelChild) Send(msg NavelMessage) error {
+	c.server.lock.Lock()
+	nw := c.writer
+	c.server.lock.Unlock()
+	if nw == nil {
+		return errors.New("navelcord is not connected")
+	}
+	return nw.WriteMessage(msg)
+}
+
+// Version returns the protocol version negotiated by hello, 0 if the child is not connected
+func (c *NavelChild) Version() int {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+	return c.version
+}
+
+// Disconnect closes the connection of the child, it can connect again with the same token
+func (c *NavelChild) Disconnect() {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// Unregister closes the connection and removes the child from the server
+func (c *NavelChild) Unregister() {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	delete(c.server.children, c.id)
+}
+
+func (c *NavelChild) logf(format string, args ...any) {
+	if c.handler.Log != nil {
+		c.handler.Log(fmt.Sprintf(format, args...))
+	} else {
+		c.server.logf(format, args...)
+	}
+}
+
+// navelPeer returns the name of the peer for logging, the peer of a unix domain socket has no address
+func navelPeer(conn net.Conn) string {
+	if addr := conn.RemoteAddr(); addr != nil && addr.String() != "" && addr.String() != "@" {
+		return addr.String()
+	}
+	return "local peer"
+}
+
+// readNavelFirst reads the first frame of a new connection within the handshake deadline.
+// It has to be hello with the token, or heartbeat of the legacy connection, see AllowLegacy.
+func readNavelFirst(conn net.Conn, nr *NavelReader, deadline time.Time) (NavelMessage, error) {
+	conn.SetReadDeadline(deadline)
+	defer conn.SetReadDeadline(time.Time{})
+	typ, body, err := nr.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	if typ != NAVEL_HELLO && typ != NAVEL_HEARTBEAT {
+		return nil, fmt.Errorf("expected hello, got type %d", typ)
+	}
+	msg, err := decodeNavelMessage(typ, body)
+	if err != nil {
+		return nil, err
+	}
+	if hello, ok := msg.(*NavelHello); ok && strings.TrimSpace(hello.Token) == "" {
+		return nil, errors.New("no token")
+	}
+	return msg, nil
+}
@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// navelTestChild registers a child that passes the messages to the returned channel
+func navelTestChild(t *testing.T, transport NavelTransport) (*NavelServer, *NavelChild, <-chan NavelMessage) {
+	t.Helper()
+	s, err := NewNavelServer(transport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	msgC := make(chan NavelMessage, 10)
+	c := s.Register("test", NavelHandler{
+		OnMessage: func(msg NavelMessage) error {
+			msgC <- msg
+			return nil
+		},
+		Log: func(string) {},
+	})
+	return s, c, msgC
+}
+
+func navelDial(t *testing.T, s *NavelServer) net.Conn {
+	t.Helper()
+	network, addr := "tcp", "127.0.0.1:"+s.Addr()
+	if _, ok := s.lsnr.(*net.UnixListener); ok {
+		network, addr = "unix", s.Addr()
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// navelRejected returns true if the server closes the connection without writing anything
+func navelRejected(t *testing.T, conn net.Conn) bool {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * navelHandshakeTimeout))
+	n, err := conn.Read(make([]byte, 1))
+	return n == 0 && (errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || strings.Contains(err.Error(), "reset"))
+}
+
+func navelTokenOf(env []string) string {
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == NAVEL_TOKEN_ENV {
+			return v
+		}
+	}
+	return ""
+}
+
+func TestNavelServerRejectsWithoutToken(t *testing.T) {
+	heartbeat := navelFrame(NAVEL_HEARTBEAT, []byte(`{"ts":1}`))
+	tests := []struct {
+		name  string
+		first []byte
+	}{
+		{"heartbeat first", heartbeat},
+		{"unknown type first", append(navelFrame(200, nil), heartbeat...)},
+		{"hello without token", navelFrame(NAVEL_HELLO, []byte(`{"version":1}`))},
+		{"hello with wrong token", navelFrame(NAVEL_HELLO, []byte(`{"version":1,"token":"wrong"}`))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c, msgC := navelTestChild(t, NavelTransportTCP)
+			c.Env()
+			conn := navelDial(t, s)
+			conn.Write(tt.first)
+			if !navelRejected(t, conn) {
+				t.Fatal("connection is not rejected")
+			}
+			select {
+			case msg := <-msgC:
+				t.Fatalf("message %#v is passed", msg)
+			default:
+			}
+		})
+	}
+}
+
+func TestNavelServerHello(t *testing.T) {
+	s, c, msgC := navelTestChild(t, NavelTransportTCP)
+	token := navelTokenOf(c.Env())
+	conn := navelDial(t, s)
+	nw := NewNavelWriter(conn)
+	if err := nw.WriteMessage(&NavelHello{Version: NAVEL_VERSION + 1, Token: token}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(navelHandshakeTimeout))
+	msg, err := NewNavelReader(conn).ReadMessage()
+	if reply, ok := msg.(*NavelHello); err != nil || !ok || reply.Version != NAVEL_VERSION {
+		t.Fatalf("reply %#v %v", msg, err)
+	}
+	nw.WriteMessage(&Heartbeat{Timestamp: 1})
+	if hb, ok := (<-msgC).(*Heartbeat); !ok || hb.Timestamp != 1 {
+		t.Fatalf("heartbeat %#v", hb)
+	}
+
+	// the same token can not connect twice at a time
+	dup := navelDial(t, s)
+	NewNavelWriter(dup).WriteMessage(&NavelHello{Version: NAVEL_VERSION, Token: token})
+	if !navelRejected(t, dup) {
+		t.Fatal("duplicate connection is not rejected")
+	}
+}
+
+func TestNavelServerLegacy(t *testing.T) {
+	heartbeat := navelFrame(NAVEL_HEARTBEAT, []byte(`{"ts":1}`))
+	t.Run("tcp can not verify the peer", func(t *testing.T) {
+		s, c, _ := navelTestChild(t, NavelTransportTCP)
+		c.Env()
+		c.AllowLegacy(os.Getpid())
+		conn := navelDial(t, s)
+		conn.Write(heartbeat)
+		if !navelRejected(t, conn) {
+			t.Fatal("connection without token is accepted on tcp")
+		}
+	})
+	if !navelPeerPidSupported {
+		return
+	}
+	t.Run("peer of the launched pid", func(t *testing.T) {
+		s, c, msgC := navelTestChild(t, NavelTransportUnix)
+		if !s.verifiesPeer() {
+			t.Skip("unix domain socket is not available")
+		}
+		c.Env()
+		// the test process is the peer of its own connection
+		c.AllowLegacy(os.Getpid())
+		conn := navelDial(t, s)
+		conn.Write(heartbeat)
+		if hb, ok := (<-msgC).(*Heartbeat); !ok || hb.Timestamp != 1 {
+			t.Fatalf("heartbeat %#v", hb)
+		}
+		if c.Version() != 0 {
+			t.Fatalf("legacy connection version %d", c.Version())
+		}
+	})
+	t.Run("peer of another pid", func(t *testing.T) {
+		s, c, _ := navelTestChild(t, NavelTransportUnix)
+		if !s.verifiesPeer() {
+			t.Skip("unix domain socket is not available")
+		}
+		c.Env()
+		c.AllowLegacy(os.Getpid() + 100000)
+		conn := navelDial(t, s)
+		conn.Write(heartbeat)
+		if !navelRejected(t, conn) {
+			t.Fatal("connection of another pid is accepted")
+		}
+	})
+	t.Run("not allowed for the new launch", func(t *testing.T) {
+		s, c, _ := navelTestChild(t, NavelTransportUnix)
+		c.Env()
+		c.AllowLegacy(os.Getpid())
+		c.Env()
+		conn := navelDial(t, s)
+		conn.Write(heartbeat)
+		if !navelRejected(t, conn) {
+			t.Fatal("connection without token is accepted after the new launch")
+		}
+	})
+}
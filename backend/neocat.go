@@ -2,121 +2,433 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
-type NeoCatAgent struct {
-	cmd  *exec.Cmd
-	host string
+// NeoCatInputType is the kind of the metrics that neocat collects
+type NeoCatInputType string
+
+const (
+	NeoCatInputCPU     NeoCatInputType = "cpu"
+	NeoCatInputMem     NeoCatInputType = "mem"
+	NeoCatInputDisk    NeoCatInputType = "disk"
+	NeoCatInputNet     NeoCatInputType = "net"
+	NeoCatInputLoad    NeoCatInputType = "load"
+	NeoCatInputSensors NeoCatInputType = "sensors"
+	NeoCatInputProc    NeoCatInputType = "proc"
+	NeoCatInputExec    NeoCatInputType = "exec"
+)
+
+// NeoCatInput is an input of a collector, each setting applies only to its input type
+type NeoCatInput struct {
+	Type       NeoCatInputType `json:"type"`
+	PerCPU     bool            `json:"perCpu,omitempty"`     // cpu, a tag per core
+	Paths      []string        `json:"paths,omitempty"`      // disk, the mount points, all if empty
+	Interfaces []string        `json:"interfaces,omitempty"` // net, the interface names, all if empty
+	Names      []string        `json:"names,omitempty"`      // proc, the process names
+	Command    string          `json:"command,omitempty"`    // exec, the command that prints the metrics
+}
+
+// NeoCatOutputType is where neocat sends the metrics
+type NeoCatOutputType string
+
+const (
+	NeoCatOutputMqtt   NeoCatOutputType = "mqtt"
+	NeoCatOutputHttp   NeoCatOutputType = "http"
+	NeoCatOutputStdout NeoCatOutputType = "stdout"
+)
+
+// NeoCatOutput is an output of a collector, mqtt and http write into the table of the collector.
+// The port, TLS and token auth follow the launch settings of the server unless they are set.
+// mqtt over TLS is refused, the server authenticates the mqtt clients over TLS with X.509
+// client certificates and neocat has no option for them.
+type NeoCatOutput struct {
+	Type     NeoCatOutputType `json:"type"`
+	Format   string           `json:"format,omitempty"`   // csv or json, csv if empty
+	Port     int              `json:"port,omitempty"`     // the mqtt-port or http-port of the server if 0
+	Tls      *bool            `json:"tls,omitempty"`      // https for http, mqtt follows MqttEnableTls if nil
+	Insecure bool             `json:"insecure,omitempty"` // skip verifying the certificate of the server
+}
+
+// NEOCAT_TOKEN_ENV carries the token of the server to neocat, not to show it in the process list
+const NEOCAT_TOKEN_ENV = "NEOCAT_TOKEN"
+
+// NeoCatTarget is the server that neocat sends the metrics to
+type NeoCatTarget struct {
+	Host          string            // the address to connect, 127.0.0.1 if the server binds all
+	Ports         map[string]string // the listening ports of the server, see listenPortFlags
+	MqttTls       bool
+	MqttTokenAuth bool
+	HttpTokenAuth bool
+	Token         string // the token for the server that enables the token auth
+}
 
-	navelcordEnabled bool
-	navelcordLsnr    *net.TCPListener
-	navelcord        net.Conn
+// NeoCatCollector is a neocat process that collects the inputs every interval into the table
+type NeoCatCollector struct {
+	Name       string         `json:"name"`
+	Interval   string         `json:"interval,omitempty"`
+	Prefix     string         `json:"prefix,omitempty"`
+	DestTable  string         `json:"table,omitempty"`
+	Inputs     []NeoCatInput  `json:"inputs"`
+	Outputs    []NeoCatOutput `json:"outputs,omitempty"` // mqtt in csv to the table if empty
+	OutputFile string         `json:"outputFile,omitempty"`
 }
 
-func (nc *NeoCatAgent) Start(opt *NeoCatOptions, logWriter io.Writer) error {
-	if nc.navelcordEnabled {
-		nc.runNavelCordServer()
+// defaultNeoCatCollector is the name of the collector made of the top level fields of NeoCatOptions
+const defaultNeoCatCollector = "neocat"
+
+// collectors returns the collectors to run, the default one first.
+// The other collectors inherit the interval and the prefix of the default one if not set.
+func (opt *NeoCatOptions) collectors() ([]*NeoCatCollector, error) {
+	def := &NeoCatCollector{
+		Name:       defaultNeoCatCollector,
+		Interval:   opt.Interval,
+		Prefix:     opt.Prefix,
+		DestTable:  opt.DestTable,
+		Outputs:    opt.Outputs,
+		OutputFile: opt.OutputFile,
 	}
-	if nc.host == "" {
-		nc.host = "127.0.0.1:5653"
+	if opt.InputCPU {
+		def.Inputs = append(def.Inputs, NeoCatInput{Type: NeoCatInputCPU})
 	}
-	args := []string{}
-	if opt.Interval != "" {
-		args = append(args, "--interval", opt.Interval)
+	if opt.InputMem {
+		def.Inputs = append(def.Inputs, NeoCatInput{Type: NeoCatInputMem})
 	}
-	if opt.Prefix != "" {
-		args = append(args, "--tag-prefix", opt.Prefix)
+	def.Inputs = append(def.Inputs, opt.Inputs...)
+
+	ret := []*NeoCatCollector{}
+	if len(def.Inputs) > 0 {
+		ret = append(ret, def)
 	}
-	if opt.InputCPU {
-		args = append(args, "--in-cpu")
+	names := map[string]bool{defaultNeoCatCollector: true}
+	for _, c := range opt.Collectors {
+		if c.Name == "" {
+			return nil, errors.New("neocat collector without name")
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("neocat collector %q is duplicated", c.Name)
+		}
+		names[c.Name] = true
+		if len(c.Inputs) == 0 {
+			return nil, fmt.Errorf("neocat collector %q has no input", c.Name)
+		}
+		cc := *c
+		if cc.Interval == "" {
+			cc.Interval = opt.Interval
+		}
+		if cc.Prefix == "" {
+			cc.Prefix = opt.Prefix
+		}
+		ret = append(ret, &cc)
 	}
-	if opt.InputMem {
-		args = append(args, "--in-mem")
+	if len(ret) == 0 {
+		return nil, errors.New("neocat has no input")
+	}
+	return ret, nil
+}
+
+// args returns the flags of neocat for the input
+func (in NeoCatInput) args() ([]string, error) {
+	args := []string{"--in-" + string(in.Type)}
+	switch in.Type {
+	case NeoCatInputCPU:
+		if in.PerCPU {
+			args = append(args, "--in-cpu-percpu")
+		}
+	case NeoCatInputMem, NeoCatInputLoad, NeoCatInputSensors:
+	case NeoCatInputDisk:
+		for _, p := range in.Paths {
+			args = append(args, "--in-disk-path", p)
+		}
+	case NeoCatInputNet:
+		for _, iface := range in.Interfaces {
+			args = append(args, "--in-net-iface", iface)
+		}
+	case NeoCatInputProc:
+		if len(in.Names) == 0 {
+			return nil, errors.New("proc input requires the process names")
+		}
+		for _, name := range in.Names {
+			args = append(args, "--in-proc-name", name)
+		}
+	case NeoCatInputExec:
+		if strings.TrimSpace(in.Command) == "" {
+			return nil, errors.New("exec input requires the command")
+		}
+		args = []string{"--in-exec", in.Command}
+	default:
+		return nil, fmt.Errorf("unknown input %q", in.Type)
+	}
+	return args, nil
+}
+
+// args returns the flags of neocat for the output
+func (out NeoCatOutput) args(table string, target NeoCatTarget) ([]string, error) {
+	format := out.Format
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		return nil, fmt.Errorf("unknown format %q of %s output", format, out.Type)
+	}
+	if out.Type == NeoCatOutputStdout {
+		return []string{"--out-stdout", format}, nil
+	}
+	if table == "" {
+		return nil, fmt.Errorf("%s output requires the table", out.Type)
+	}
+	var args []string
+	var tokenAuth bool
+	switch out.Type {
+	case NeoCatOutputMqtt:
+		port := target.Ports["mqtt-port"]
+		if out.Port > 0 {
+			port = strconv.Itoa(out.Port)
+		}
+		if (out.Tls == nil && target.MqttTls) || (out.Tls != nil && *out.Tls) {
+			return nil, errors.New("mqtt over TLS requires a client certificate that neocat does not support, use the http output or disable mqtt-enable-tls")
+		}
+		args = []string{"--out-mqtt", fmt.Sprintf("tcp://%s/db/append/%s:%s", net.JoinHostPort(target.Host, port), table, format)}
+		tokenAuth = target.MqttTokenAuth
+	case NeoCatOutputHttp:
+		port := target.Ports["http-port"]
+		if out.Port > 0 {
+			port = strconv.Itoa(out.Port)
+		}
+		scheme := "http"
+		if out.Tls != nil && *out.Tls {
+			scheme = "https"
+		}
+		args = []string{"--out-http", fmt.Sprintf("%s://%s/db/write/%s?format=%s", scheme, net.JoinHostPort(target.Host, port), table, format)}
+		tokenAuth = target.HttpTokenAuth
+	default:
+		return nil, fmt.Errorf("unknown output %q", out.Type)
+	}
+	if tokenAuth {
+		if target.Token == "" {
+			return nil, fmt.Errorf("the server requires a token for %s output", out.Type)
+		}
+		args = append(args, "--out-token-env", NEOCAT_TOKEN_ENV)
+	}
+	if out.Insecure {
+		args = append(args, "--out-insecure")
+	}
+	return args, nil
+}
+
+// args returns the flags of neocat for the collector that sends the metrics to the target
+func (c *NeoCatCollector) args(target NeoCatTarget) ([]string, error) {
+	args := []string{}
+	if c.Interval != "" {
+		args = append(args, "--interval", c.Interval)
+	}
+	if c.Prefix != "" {
+		args = append(args, "--tag-prefix", c.Prefix)
+	}
+	for _, in := range c.Inputs {
+		inArgs, err := in.args()
+		if err != nil {
+			return nil, fmt.Errorf("neocat collector %q, %s", c.Name, err.Error())
+		}
+		args = append(args, inArgs...)
 	}
 
-	if opt.DestTable != "" {
-		args = append(args, "--out-mqtt", fmt.Sprintf("tcp://%s/db/append/%s:csv", nc.host, opt.DestTable))
+	for _, out := range c.outputs() {
+		outArgs, err := out.args(c.DestTable, target)
+		if err != nil {
+			return nil, fmt.Errorf("neocat collector %q, %s", c.Name, err.Error())
+		}
+		args = append(args, outArgs...)
 	}
-	if opt.OutputFile != "" {
-		args = append(args, "--out-file", opt.OutputFile)
+	if c.OutputFile != "" {
+		args = append(args, "--out-file", c.OutputFile)
 	}
 
 	args = append(args, "--log-filename", "-")
 	args = append(args, "--log-level", "DEBUG")
+	return args, nil
+}
+
+// outputs returns the outputs of the collector, it writes into the table over mqtt if no output is given
+func (c *NeoCatCollector) outputs() []NeoCatOutput {
+	if len(c.Outputs) == 0 && c.DestTable != "" {
+		return []NeoCatOutput{{Type: NeoCatOutputMqtt}}
+	}
+	return c.Outputs
+}
 
-	nc.cmd = exec.Command(opt.BinPath, args...)
-	nc.cmd.Env = os.Environ()
-	if v := nc.navelcordEnv(); nc.navelcordEnabled && v != "" {
-		nc.cmd.Env = append(nc.cmd.Env, v)
+// serverTable returns the table that the collector writes into the server, it is empty if no output goes to the server
+func (c *NeoCatCollector) serverTable() string {
+	for _, out := range c.outputs() {
+		if out.Type == NeoCatOutputMqtt || out.Type == NeoCatOutputHttp {
+			return c.DestTable
+		}
 	}
-	sysProcAttr(nc.cmd)
+	return ""
+}
 
-	stdout, _ := nc.cmd.StdoutPipe()
+// NeoCatAgent supervises a neocat collector that collects the metrics of the host into machbase-neo
+type NeoCatAgent struct {
+	*ManagedProcess
+	target    NeoCatTarget
+	binPath   string
+	collector *NeoCatCollector
+}
 
-	if logWriter != nil {
-		go io.Copy(logWriter, stdout)
+// NewNeoCatAgent opens the agent that sends the metrics to the target server.
+// neocat does not use navelcord, it can not send the hello with the token, it follows the server as a dependent instead.
+// The output of neocat, stdout and stderr, goes to logWriter, stateCallback receives every state change.
+func NewNeoCatAgent(name string, target NeoCatTarget, logWriter io.Writer, stateCallback func(NeoStatus)) *NeoCatAgent {
+	nc := &NeoCatAgent{
+		ManagedProcess: newManagedProcess(name),
+		target:         target,
 	}
-	err := nc.cmd.Start()
-	return err
+	nc.command = nc.catCommand
+	nc.stdoutWriter = logWriter
+	nc.stderrWriter = logWriter
+	nc.logWriter = logWriter
+	nc.stateCallback = stateCallback
+	nc.Open()
+	return nc
 }
 
-func (nc *NeoCatAgent) Stop() {
-	if nc.cmd != nil {
-		nc.cmd.Process.Kill()
+// Start launches neocat of the binPath for the collector
+func (nc *NeoCatAgent) Start(binPath string, collector *NeoCatCollector) error {
+	nc.binPath = binPath
+	nc.collector = collector
+	return nc.ManagedProcess.Start()
+}
+
+func (nc *NeoCatAgent) catCommand() (*exec.Cmd, error) {
+	args, err := nc.collector.args(nc.target)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNeoCatArgs(nc.binPath, args); err != nil {
+		return nil, err
 	}
-	if nc.navelcordLsnr != nil {
-		nc.navelcordLsnr.Close()
+	cmd := exec.Command(nc.binPath, args...)
+	cmd.Env = os.Environ()
+	if nc.target.Token != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", NEOCAT_TOKEN_ENV, nc.target.Token))
 	}
+	return cmd, nil
 }
 
-func (nc *NeoCatAgent) navelcordEnv() string {
-	if nc.navelcordLsnr != nil {
-		navelPort := strings.TrimPrefix(nc.navelcordLsnr.Addr().String(), "127.0.0.1:")
-		return fmt.Sprintf("%s=%s", NAVEL_ENV, navelPort)
+// discovered flags of the neocat binaries, keyed by the path of the binary
+var (
+	neocatFlagSets     = map[string]map[string]bool{}
+	neocatFlagSetsLock sync.Mutex
+)
+
+// neocatBaseFlags are the flags that the launcher has passed to neocat from the first version
+var neocatBaseFlags = []string{"interval", "tag-prefix", "in-cpu", "in-mem", "out-mqtt", "out-file", "log-filename", "log-level"}
+
+// neocatFlagsOf returns the flags in 'neocat --help' of the binary,
+// it returns neocatBaseFlags if the help shows no flag.
+func neocatFlagsOf(binPath string) (map[string]bool, error) {
+	neocatFlagSetsLock.Lock()
+	defer neocatFlagSetsLock.Unlock()
+	if flags, ok := neocatFlagSets[binPath]; ok {
+		return flags, nil
 	}
-	return ""
+	help, err := runHelper(binPath, "--help")
+	if err != nil {
+		return nil, err
+	}
+	names := parseNeoCatHelp(help)
+	if len(names) == 0 {
+		names = neocatBaseFlags
+	}
+	flags := map[string]bool{}
+	for _, name := range names {
+		flags[name] = true
+	}
+	neocatFlagSets[binPath] = flags
+	return flags, nil
+}
+
+// e.g. the flag package and kong
+//
+//	-in-cpu
+//	  	collect cpu usage
+//	--out-mqtt=STRING    mqtt url to write
+var regexpNeoCatHelpFlag = regexp.MustCompile(`^\s+(?:-\w,\s+)?--?(?:\[no-\])?([a-z][a-z0-9\-]*)`)
+
+// parseNeoCatHelp returns the names of the flags in the output of 'neocat --help'
+func parseNeoCatHelp(help string) []string {
+	ret := []string{}
+	for _, line := range strings.Split(help, "\n") {
+		if m := regexpNeoCatHelpFlag.FindStringSubmatch(line); m != nil {
+			ret = append(ret, m[1])
+		}
+	}
+	return ret
 }
 
-func (na *NeoCatAgent) runNavelCordServer() {
-	if lsnr, err := net.Listen("tcp", "127.0.0.1:0"); err == nil {
-		na.navelcordLsnr = lsnr.(*net.TCPListener)
-	}
-	go func() {
-		for {
-			if conn, err := na.navelcordLsnr.Accept(); err != nil {
-				// when launcher is shutdown
-				break
-			} else {
-				na.navelcord = conn
-			}
-			for {
-				hb := Heartbeat{}
-				if err := hb.Unmarshal(na.navelcord); err != nil {
-					break
-				}
-
-				hb.Ack = time.Now().UnixNano()
-				if pkt, err := hb.Marshal(); err != nil {
-					break
-				} else {
-					na.navelcord.Write(pkt)
-				}
-			}
-			if na.navelcord != nil {
-				na.navelcord.Close()
-				na.navelcord = nil
-			}
-		}
-	}()
+// checkNeoCatArgs returns an error for the first flag in args that the neocat binary does not support
+func checkNeoCatArgs(binPath string, args []string) error {
+	flags, err := neocatFlagsOf(binPath)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if name, ok := strings.CutPrefix(arg, "--"); ok && !flags[name] {
+			return fmt.Errorf("this neocat does not support --%s, see 'neocat --help'", name)
+		}
+	}
+	return nil
+}
+
+// neocatDependent makes neocat follow the server of the instance,
+// neocat starts when the server is ready and stops before the server stops.
+type neocatDependent struct {
+	inst *Instance
+}
+
+// StartDependent starts neocat if it is auto-started, or if it was stopped with the server
+func (d *neocatDependent) StartDependent() {
+	a := d.inst.app
+	a.neocatLock.Lock()
+	defer a.neocatLock.Unlock()
+	resume := a.neocatResume && a.neocatFor == d.inst.name()
+	auto := a.conf.NeoCatOptions.AutoStart && d.inst.isActive()
+	if !resume && !auto {
+		return
+	}
+	if a.neocatRunning() {
+		return
+	}
+	a.neocatResume = false
+	if err := a.startNeoCat(d.inst); err != nil {
+		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), "neocat error "+err.Error()+"\r\n")
+	}
+}
+
+// StopDependent stops neocat that pushes to the server, and remembers to start it again
+func (d *neocatDependent) StopDependent() {
+	a := d.inst.app
+	a.neocatLock.Lock()
+	defer a.neocatLock.Unlock()
+	if len(a.neocatAgents) == 0 || a.neocatFor != d.inst.name() {
+		return
+	}
+	if a.neocatRunning() {
+		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), "Stopping neocat before machbase-neo...\r\n")
+		a.neocatResume = true
+	}
+	a.stopNeoCat()
 }
 
 func (a *App) NewLogWriter() io.Writer {
@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestParseNeoCatHelp(t *testing.T) {
+	tests := []struct {
+		name string
+		help string
+		want []string
+	}{
+		{
+			name: "flag package",
+			help: "Usage of neocat:\n  -in-cpu\n    \tcollect cpu usage\n  -interval duration\n    \tcollect interval (default 10s)\n",
+			want: []string{"in-cpu", "interval"},
+		},
+		{
+			name: "kong",
+			help: "Usage: neocat\n\nFlags:\n  -h, --help                 Show context-sensitive help.\n      --out-mqtt=STRING      mqtt url\n      --[no-]in-mem          collect memory usage\n",
+			want: []string{"help", "out-mqtt", "in-mem"},
+		},
+		{
+			name: "no flags",
+			help: "neocat v1.0.0\n",
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNeoCatHelp(tt.help); !slices.Equal(got, tt.want) {
+				t.Fatalf("flags %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNeoCatArgs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test neocat is a shell script")
+	}
+	newNeoCat := func(help string) string {
+		binPath := filepath.Join(t.TempDir(), "neocat")
+		script := "#!/bin/sh\ncat <<'EOF'\n" + help + "EOF\n"
+		if err := os.WriteFile(binPath, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return binPath
+	}
+	withHelp := newNeoCat("  -in-cpu\n  -in-disk\n  -in-disk-path string\n  -log-filename string\n")
+	withoutHelp := newNeoCat("neocat\n")
+	tests := []struct {
+		name    string
+		binPath string
+		args    []string
+		ok      bool
+	}{
+		{"discovered", withHelp, []string{"--in-disk", "--in-disk-path", "/", "--log-filename", "-"}, true},
+		{"not in help", withHelp, []string{"--in-cpu", "--in-sensors"}, false},
+		{"base flags", withoutHelp, []string{"--interval", "10s", "--in-cpu", "--out-mqtt", "tcp://127.0.0.1:5653"}, true},
+		{"not a base flag", withoutHelp, []string{"--in-cpu", "--out-http", "http://127.0.0.1:5654"}, false},
+		{"missing binary", filepath.Join(t.TempDir(), "neocat"), []string{"--in-cpu"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkNeoCatArgs(tt.binPath, tt.args); (err == nil) != tt.ok {
+				t.Fatalf("check %v, error %v", tt.args, err)
+			}
+		})
+	}
+}
+
+func TestNeoCatOutputArgs(t *testing.T) {
+	yes, no := true, false
+	target := NeoCatTarget{Host: "127.0.0.1", Ports: map[string]string{"mqtt-port": "5653", "http-port": "5654"}}
+	tlsTarget := target
+	tlsTarget.MqttTls = true
+	tests := []struct {
+		name   string
+		out    NeoCatOutput
+		target NeoCatTarget
+		want   []string
+	}{
+		{"mqtt", NeoCatOutput{Type: NeoCatOutputMqtt}, target, []string{"--out-mqtt", "tcp://127.0.0.1:5653/db/append/EXAMPLE:csv"}},
+		{"mqtt json", NeoCatOutput{Type: NeoCatOutputMqtt, Format: "json", Port: 1883}, target, []string{"--out-mqtt", "tcp://127.0.0.1:1883/db/append/EXAMPLE:json"}},
+		{"mqtt to the tls server", NeoCatOutput{Type: NeoCatOutputMqtt}, tlsTarget, nil},
+		{"mqtt with tls", NeoCatOutput{Type: NeoCatOutputMqtt, Tls: &yes}, target, nil},
+		{"mqtt without tls", NeoCatOutput{Type: NeoCatOutputMqtt, Tls: &no}, tlsTarget, []string{"--out-mqtt", "tcp://127.0.0.1:5653/db/append/EXAMPLE:csv"}},
+		{"https", NeoCatOutput{Type: NeoCatOutputHttp, Tls: &yes}, tlsTarget, []string{"--out-http", "https://127.0.0.1:5654/db/write/EXAMPLE?format=csv"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.out.args("EXAMPLE", tt.target)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("args %v, expected an error", got)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Fatalf("args %v %v, expected %v", got, err, tt.want)
+			}
+		})
+	}
+}
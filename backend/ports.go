@@ -0,0 +1,117 @@
+package backend
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// LaunchError is the reason that the launcher refuses to start the server or neocat, it is sent as EVT_ERROR
+type LaunchError struct {
+	Instance  string           `json:"instance,omitempty"`
+	Reason    string           `json:"reason"`
+	Message   string           `json:"message"`
+	Conflicts []PortConflict   `json:"conflicts,omitempty"`
+	Table     string           `json:"table,omitempty"`   // the table of table-missing and table-schema
+	Columns   []ColumnMismatch `json:"columns,omitempty"` // of table-schema
+}
+
+const (
+	LaunchErrorPortConflict = "port-conflict"
+	LaunchErrorTableMissing = "table-missing"
+	LaunchErrorTableSchema  = "table-schema"
+)
+
+// PortConflict is a listening port of the server that can not be bound
+type PortConflict struct {
+	Flag    string `json:"flag"`
+	Addr    string `json:"addr"`
+	Port    int    `json:"port"`
+	Error   string `json:"error"`
+	Pid     int    `json:"pid,omitempty"`
+	Process string `json:"process,omitempty"`
+	Suggest int    `json:"suggest,omitempty"`
+}
+
+func (e *LaunchError) Error() string {
+	lines := []string{e.Message}
+	for _, c := range e.Conflicts {
+		line := fmt.Sprintf("--%s %s", c.Flag, c.Error)
+		if c.Pid != 0 {
+			line = fmt.Sprintf("--%s %s is in use by %s (pid: %d)", c.Flag, c.Addr, c.Process, c.Pid)
+		}
+		if c.Suggest != 0 {
+			line += fmt.Sprintf(", try --%s %d", c.Flag, c.Suggest)
+		}
+		lines = append(lines, line)
+	}
+	for _, c := range e.Columns {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n  ")
+}
+
+// checkListenPorts probes every port that the server will listen on,
+// it returns *LaunchError if any of them is taken.
+func checkListenPorts(launch *LaunchCmdWithFlags) error {
+	g := guessBindAddress(launch.Flags)
+	ports := map[string]int{}
+	reserved := map[int]bool{}
+	for _, name := range listenPortFlags {
+		port, err := strconv.Atoi(g.ports[name])
+		if err != nil || port <= 0 {
+			continue
+		}
+		ports[name] = port
+		reserved[port] = true
+	}
+	conflicts := []PortConflict{}
+	for _, name := range listenPortFlags {
+		port, ok := ports[name]
+		if !ok {
+			continue
+		}
+		addr := net.JoinHostPort(g.host, strconv.Itoa(port))
+		if err := probePort(addr); err != nil {
+			c := PortConflict{Flag: name, Addr: addr, Port: port, Error: err.Error()}
+			c.Pid, c.Process = portOwner(port)
+			conflicts = append(conflicts, c)
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	for i := range conflicts {
+		if free := freePort(g.host, conflicts[i].Port+1, reserved); free != 0 {
+			conflicts[i].Suggest = free
+			reserved[free] = true
+		}
+	}
+	return &LaunchError{
+		Reason:    LaunchErrorPortConflict,
+		Message:   "can not start machbase-neo, the listening ports are already in use",
+		Conflicts: conflicts,
+	}
+}
+
+func probePort(addr string) error {
+	lsnr, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return lsnr.Close()
+}
+
+// freePort returns a port that can be bound from the port 'from', or 0 if not found
+func freePort(host string, from int, reserved map[int]bool) int {
+	for port := from; port < from+100 && port <= 65535; port++ {
+		if reserved[port] {
+			continue
+		}
+		if probePort(net.JoinHostPort(host, strconv.Itoa(port))) == nil {
+			return port
+		}
+	}
+	return 0
+}
@@ -0,0 +1,279 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const defaultProfileName = "default"
+
+// Profile is a named launch configuration
+type Profile struct {
+	Name           string         `json:"name"`
+	LaunchOptions  *LaunchOptions `json:"launchOptions"`
+	RecentDirList  []string       `json:"recentDirList,omitempty"`
+	RecentFileList []string       `json:"recentFileList,omitempty"`
+}
+
+func defaultLaunchOptions() *LaunchOptions {
+	return &LaunchOptions{
+		Host:     "127.0.0.1",
+		LogLevel: "INFO",
+	}
+}
+
+// migrateProfiles moves the launch options of the old config file into the default profile
+func (a *App) migrateProfiles() {
+	if len(a.conf.Profiles) == 0 {
+		opts := a.conf.LaunchOptions
+		if opts == nil {
+			opts = defaultLaunchOptions()
+		}
+		a.conf.Profiles = []*Profile{{
+			Name:           defaultProfileName,
+			LaunchOptions:  opts,
+			RecentDirList:  a.conf.UI.RecentDirList,
+			RecentFileList: a.conf.UI.RecentFileList,
+		}}
+	}
+	for _, p := range a.conf.Profiles {
+		if p.LaunchOptions == nil {
+			p.LaunchOptions = defaultLaunchOptions()
+		}
+	}
+	a.conf.LaunchOptions = nil
+	a.conf.UI.RecentDirList = nil
+	a.conf.UI.RecentFileList = nil
+	if a.findProfile(a.conf.ActiveProfile) == nil {
+		a.conf.ActiveProfile = a.conf.Profiles[0].Name
+	}
+}
+
+func (a *App) findProfile(name string) *Profile {
+	for _, p := range a.conf.Profiles {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// activeProfile returns the active profile, the caller holds confLock
+func (a *App) activeProfile() *Profile {
+	if a.headlessProfile != "" {
+		if p := a.findProfile(a.headlessProfile); p != nil {
+			return p
+		}
+	}
+	if p := a.findProfile(a.conf.ActiveProfile); p != nil {
+		return p
+	}
+	return a.conf.Profiles[0]
+}
+
+// launchOptions returns the launch options of the active profile.
+// The launch options are replaced as a whole on change and never modified in place,
+// the caller can read the returned options without confLock.
+func (a *App) launchOptions() *LaunchOptions {
+	a.confLock.RLock()
+	defer a.confLock.RUnlock()
+	return a.activeProfile().LaunchOptions
+}
+
+func (a *App) activeProfileName() string {
+	a.confLock.RLock()
+	defer a.confLock.RUnlock()
+	return a.activeProfile().Name
+}
+
+// setBinPath replaces the launch options of the active profile with the bin path changed
+func (a *App) setBinPath(binPath string) {
+	a.confLock.Lock()
+	defer a.confLock.Unlock()
+	p := a.activeProfile()
+	opts := *p.LaunchOptions
+	opts.BinPath = binPath
+	p.LaunchOptions = &opts
+}
+
+func (a *App) checkNewProfileName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("profile name is empty")
+	}
+	if a.findProfile(name) != nil {
+		return "", fmt.Errorf("profile %q already exists", name)
+	}
+	return name, nil
+}
+
+func (a *App) DoGetProfiles() []string {
+	a.confLock.RLock()
+	defer a.confLock.RUnlock()
+	ret := make([]string, len(a.conf.Profiles))
+	for i, p := range a.conf.Profiles {
+		ret[i] = p.Name
+	}
+	return ret
+}
+
+func (a *App) DoGetActiveProfile() string {
+	return a.activeProfileName()
+}
+
+// DoCreateProfile creates a profile with the default launch options
+func (a *App) DoCreateProfile(name string) error {
+	a.confLock.Lock()
+	name, err := a.checkNewProfileName(name)
+	if err != nil {
+		a.confLock.Unlock()
+		return err
+	}
+	opts := defaultLaunchOptions()
+	opts.BinPath = a.activeProfile().LaunchOptions.BinPath
+	a.conf.Profiles = append(a.conf.Profiles, &Profile{Name: name, LaunchOptions: opts})
+	a.confLock.Unlock()
+	a.saveLaunchOptions()
+	return nil
+}
+
+func (a *App) DoCloneProfile(src string, name string) error {
+	if err := a.cloneProfile(src, name); err != nil {
+		return err
+	}
+	a.saveLaunchOptions()
+	return nil
+}
+
+func (a *App) cloneProfile(src string, name string) error {
+	a.confLock.Lock()
+	defer a.confLock.Unlock()
+	org := a.findProfile(src)
+	if org == nil {
+		return fmt.Errorf("profile %q not found", src)
+	}
+	name, err := a.checkNewProfileName(name)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(org)
+	if err != nil {
+		return err
+	}
+	clone := &Profile{}
+	if err := json.Unmarshal(content, clone); err != nil {
+		return err
+	}
+	clone.Name = name
+	a.conf.Profiles = append(a.conf.Profiles, clone)
+	return nil
+}
+
+func (a *App) DoRenameProfile(name string, newName string) error {
+	if err := a.renameProfile(name, newName); err != nil {
+		return err
+	}
+	a.saveLaunchOptions()
+	return nil
+}
+
+// renameProfile renames the profile and its instance together,
+// the supervisor finds the launch options of the instance by its id.
+func (a *App) renameProfile(name string, newName string) error {
+	a.confLock.Lock()
+	defer a.confLock.Unlock()
+	p := a.findProfile(name)
+	if p == nil {
+		return fmt.Errorf("profile %q not found", name)
+	}
+	newName, err := a.checkNewProfileName(newName)
+	if err != nil {
+		return err
+	}
+	p.Name = newName
+	a.renameInstance(name, newName)
+	if a.conf.ActiveProfile == name {
+		a.conf.ActiveProfile = newName
+	}
+	return nil
+}
+
+func (a *App) DoDeleteProfile(name string) error {
+	deletedActive, removed, err := a.deleteProfile(name)
+	if err != nil {
+		return err
+	}
+	if removed != nil {
+		removed.agent.Close()
+	}
+	a.saveLaunchOptions()
+	if deletedActive {
+		a.showActiveInstance()
+	}
+	return nil
+}
+
+// deleteProfile deletes the profile and returns the removed instance of it to be closed
+func (a *App) deleteProfile(name string) (deletedActive bool, removed *Instance, err error) {
+	a.confLock.Lock()
+	defer a.confLock.Unlock()
+	if len(a.conf.Profiles) == 1 {
+		return false, nil, errors.New("can not delete the last profile")
+	}
+	idx := slices.IndexFunc(a.conf.Profiles, func(p *Profile) bool { return p.Name == name })
+	if idx < 0 {
+		return false, nil, fmt.Errorf("profile %q not found", name)
+	}
+	removed, err = a.removeInstance(name)
+	if err != nil {
+		return false, nil, err
+	}
+	a.conf.Profiles = slices.Delete(a.conf.Profiles, idx, idx+1)
+	deletedActive = a.conf.ActiveProfile == name
+	if deletedActive {
+		a.conf.ActiveProfile = a.conf.Profiles[0].Name
+	}
+	return deletedActive, removed, nil
+}
+
+func (a *App) DoActivateProfile(name string) error {
+	a.confLock.Lock()
+	p := a.findProfile(name)
+	if p == nil {
+		a.confLock.Unlock()
+		return fmt.Errorf("profile %q not found", name)
+	}
+	if a.conf.ActiveProfile == name {
+		a.confLock.Unlock()
+		return nil
+	}
+	binPath := a.activeProfile().LaunchOptions.BinPath
+	if p.LaunchOptions.BinPath == "" {
+		opts := *p.LaunchOptions
+		opts.BinPath = binPath
+		p.LaunchOptions = &opts
+	} else if p.LaunchOptions.BinPath != binPath {
+		a.discoverFlags(p.LaunchOptions.BinPath)
+	}
+	a.conf.ActiveProfile = name
+	a.confLock.Unlock()
+	a.saveLaunchOptions()
+	a.showActiveInstance()
+	return nil
+}
+
+// showActiveInstance shows the terminal and the state of the instance of the active profile
+func (a *App) showActiveInstance() {
+	inst := a.activeInstance()
+	wailsRuntime.EventsEmit(a.ctx, string(EVT_TERM), `\033c`)
+	if log := inst.logString(); log != "" {
+		wailsRuntime.EventsEmit(a.ctx, string(EVT_LOG), log)
+	}
+	inst.emitState()
+	a.emitLaunchCmdWithFlags()
+}
@@ -0,0 +1,651 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ManagedProcess supervises a child process of the launcher.
+// It launches the command, captures the output, waits until the process is ready,
+// restarts it by the restart policy when it exits unexpectedly and stops it in stages.
+// The server and the helper tools share the lifecycle, only the hooks differ.
+type ManagedProcess struct {
+	name string // for logging, e.g. "machbase-neo"
+
+	// hooks
+	command     func() (*exec.Cmd, error)    // builds the command of each launch
+	readyCheck  func() error                 // polled until it returns nil, ready on launch if nil
+	onReady     func(exitC <-chan struct{})  // runs after ready until exitC is closed
+	requestStop func(timeout time.Duration)  // asks the process to stop before the terminate signal
+	onNavel     func(msg NavelMessage) error // receives the navelcord messages except ready
+
+	stdoutWriter  io.Writer
+	stderrWriter  io.Writer
+	logWriter     io.Writer
+	process       *os.Process // guarded by statusLock
+	stateC        chan NeoStatus
+	stateLock     sync.Mutex // serializes the state changes, and guards stateC against Close
+	stateClosed   bool
+	stateCallback func(NeoStatus)
+	stopTimeout   func() time.Duration
+	restartPolicy func() RestartOptions
+	preflight     func() error
+	readyTimeout  func() time.Duration
+	statusLock    sync.Mutex
+	state         NeoState
+	restarts      int
+	failures      int
+	lastExit      string
+	exitCode      int
+	reason        string
+	ready         bool
+	readyC        chan struct{}
+	stopRequested bool
+	restartCancel chan struct{}
+	done          chan struct{} // closed when the run from Start ends in the final state, nil if not running
+
+	navelcordEnabled bool
+	navelLegacy      func() bool // the launch may connect without token, see NavelChild.AllowLegacy
+	navelServer      *NavelServer
+	ownNavelServer   bool // the server is created by Open(), not given by WithNavelServer
+	navel            *NavelChild
+
+	dependents     []Dependent
+	dependentsLock sync.Mutex
+}
+
+// Dependent is a process that can run only while the process it depends on is ready,
+// e.g. neocat pushes the metrics to the mqtt port of machbase-neo.
+type Dependent interface {
+	// StartDependent is called when the process it depends on becomes ready
+	StartDependent()
+	// StopDependent is called before the process it depends on is stopped, or after it exits
+	StopDependent()
+}
+
+func newManagedProcess(name string) *ManagedProcess {
+	return &ManagedProcess{
+		name:   name,
+		stateC: make(chan NeoStatus),
+		state:  NeoStopped,
+	}
+}
+
+func (mp *ManagedProcess) Open() {
+	if mp.Pid() != 0 {
+		mp.setState(NeoRunning)
+		return
+	}
+	go func() {
+		for state := range mp.stateC {
+			if mp.stateCallback == nil {
+				continue
+			}
+			mp.stateCallback(state)
+		}
+	}()
+	mp.setState(NeoStopped)
+
+	if mp.navelcordEnabled {
+		mp.openNavelcord()
+	}
+}
+
+func (mp *ManagedProcess) Close() {
+	if mp.navel != nil {
+		mp.navel.Unregister()
+	}
+	if mp.ownNavelServer {
+		mp.navelServer.Close()
+	}
+	mp.stateLock.Lock()
+	defer mp.stateLock.Unlock()
+	if mp.stateC != nil && !mp.stateClosed {
+		mp.stateClosed = true
+		close(mp.stateC)
+	}
+}
+
+func (mp *ManagedProcess) setState(state NeoState) {
+	mp.stateLock.Lock()
+	defer mp.stateLock.Unlock()
+	mp.statusLock.Lock()
+	mp.state = state
+	status := mp.statusLocked()
+	mp.statusLock.Unlock()
+	if !mp.stateClosed {
+		mp.stateC <- status
+	}
+}
+
+// finish ends the run with the final state, Stop waits for it
+func (mp *ManagedProcess) finish(state NeoState) {
+	mp.setState(state)
+	mp.statusLock.Lock()
+	done := mp.done
+	mp.done = nil
+	mp.statusLock.Unlock()
+	if done != nil {
+		close(done)
+	}
+}
+
+// Wait blocks until the current run ends in its final state, e.g. the process has exited
+// and it is not going to be restarted. It returns immediately if it is not running.
+func (mp *ManagedProcess) Wait() {
+	mp.statusLock.Lock()
+	done := mp.done
+	mp.statusLock.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (mp *ManagedProcess) Status() NeoStatus {
+	mp.statusLock.Lock()
+	defer mp.statusLock.Unlock()
+	return mp.statusLocked()
+}
+
+func (mp *ManagedProcess) statusLocked() NeoStatus {
+	return NeoStatus{
+		State:    mp.state,
+		Pid:      mp.pidLocked(),
+		Restarts: mp.restarts,
+		LastExit: mp.lastExit,
+		ExitCode: mp.exitCode,
+		Reason:   mp.reason,
+	}
+}
+
+// IsReady returns true if the process is running and passed the ready check
+func (mp *ManagedProcess) IsReady() bool {
+	mp.statusLock.Lock()
+	defer mp.statusLock.Unlock()
+	return mp.ready && mp.state == NeoRunning
+}
+
+func (mp *ManagedProcess) Pid() int {
+	mp.statusLock.Lock()
+	defer mp.statusLock.Unlock()
+	return mp.pidLocked()
+}
+
+func (mp *ManagedProcess) pidLocked() int {
+	if mp.process != nil {
+		return mp.process.Pid
+	}
+	return 0
+}
+
+// runningProcess returns the process of the current launch, nil if it is not launched
+func (mp *ManagedProcess) runningProcess() *os.Process {
+	mp.statusLock.Lock()
+	defer mp.statusLock.Unlock()
+	return mp.process
+}
+
+// Start runs the preflight check and launches the process.
+// It refuses while the previous run is not over, e.g. the process is waiting for the next restart.
+func (mp *ManagedProcess) Start() error {
+	mp.statusLock.Lock()
+	if mp.done != nil {
+		mp.statusLock.Unlock()
+		return fmt.Errorf("%s is already running", mp.name)
+	}
+	mp.done = make(chan struct{})
+	mp.stopRequested = false
+	mp.restarts = 0
+	mp.failures = 0
+	mp.reason = ""
+	mp.statusLock.Unlock()
+	if mp.preflight != nil {
+		if err := mp.preflight(); err != nil {
+			mp.log(err.Error())
+			mp.finish(NeoStopped)
+			return err
+		}
+	}
+	return mp.start(false)
+}
+
+// start launches the process, relaunch is true if the restart policy launches it again
+func (mp *ManagedProcess) start(relaunch bool) error {
+	mp.setState(NeoStarting)
+
+	cmd, err := mp.command()
+	if err == nil {
+		if mp.navel != nil {
+			if cmd.Env == nil {
+				cmd.Env = os.Environ()
+			}
+			cmd.Env = append(cmd.Env, mp.navel.Env()...)
+		}
+		sysProcAttr(cmd)
+		if mp.stdoutWriter != nil {
+			stdout, _ := cmd.StdoutPipe()
+			go io.Copy(mp.stdoutWriter, stdout)
+		}
+		if mp.stderrWriter != nil {
+			stderr, _ := cmd.StderrPipe()
+			go io.Copy(mp.stderrWriter, stderr)
+		}
+		err = cmd.Start()
+	}
+	if err != nil {
+		mp.log(err.Error())
+		mp.statusLock.Lock()
+		mp.lastExit = err.Error()
+		mp.statusLock.Unlock()
+		if relaunch {
+			if delay, ok := mp.nextRestart(true, 0); ok {
+				go mp.restartAfter(delay)
+				return err
+			}
+		}
+		mp.statusLock.Lock()
+		mp.reason = err.Error()
+		mp.statusLock.Unlock()
+		mp.finish(NeoFailed)
+		return err
+	}
+	if mp.navel != nil && mp.navelLegacy != nil && mp.navelLegacy() {
+		mp.navel.AllowLegacy(cmd.Process.Pid)
+	}
+	mp.statusLock.Lock()
+	mp.process = cmd.Process
+	stopped := mp.stopRequested
+	mp.statusLock.Unlock()
+	if stopped {
+		// Stop came while launching, it waits for the exit of this process
+		terminateProcess(cmd.Process)
+	}
+	startTime := time.Now()
+	readyC := make(chan struct{})
+	exitC := make(chan struct{})
+
+	mp.statusLock.Lock()
+	mp.ready = false
+	mp.readyC = readyC
+	mp.statusLock.Unlock()
+
+	go mp.waitReady(readyC, exitC)
+	go func() {
+		state, err := cmd.Process.Wait()
+		close(exitC)
+		failed := true
+		mp.statusLock.Lock()
+		if err != nil {
+			mp.log(fmt.Sprintf("Shutdown failed %s", err.Error()))
+			mp.lastExit = err.Error()
+			mp.exitCode = -1
+		} else {
+			mp.log(fmt.Sprintf("Shutdown done (exit code: %d)", state.ExitCode()))
+			mp.lastExit = state.String()
+			mp.exitCode = state.ExitCode()
+			failed = state.ExitCode() != 0
+		}
+		userStop := mp.stopRequested
+		wasReady := mp.ready
+		mp.ready = false
+		mp.readyC = nil
+		mp.process = nil
+		mp.statusLock.Unlock()
+		mp.stopDependents()
+
+		if !userStop {
+			if delay, ok := mp.nextRestart(failed, time.Since(startTime)); ok {
+				mp.restartAfter(delay)
+				return
+			}
+			mp.statusLock.Lock()
+			if !wasReady {
+				mp.reason = fmt.Sprintf("exited before ready (%s)", mp.lastExit)
+			} else if failed {
+				mp.reason = fmt.Sprintf("exited unexpectedly (%s)", mp.lastExit)
+			}
+			mp.statusLock.Unlock()
+		}
+		// Stop returns after the final state, so that Start can follow it immediately
+		if mp.Status().Reason != "" {
+			mp.finish(NeoFailed)
+		} else {
+			mp.finish(NeoStopped)
+		}
+	}()
+	return nil
+}
+
+// waitReady keeps the process in starting until the ready check passes
+// or the process sends the ready message over navelcord. If it is not ready within the ready timeout,
+// it is stopped and turns to failed. Once ready, onReady runs until the process exits.
+func (mp *ManagedProcess) waitReady(readyC <-chan struct{}, exitC <-chan struct{}) {
+	if mp.readyCheck == nil {
+		mp.becomeReady(exitC)
+		return
+	}
+	timeout := defaultReadyTimeout
+	if mp.readyTimeout != nil {
+		if d := mp.readyTimeout(); d > 0 {
+			timeout = d
+		}
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	lastErr := "no response"
+	for {
+		select {
+		case <-exitC:
+			return
+		case <-readyC:
+		case <-ticker.C:
+			if err := mp.readyCheck(); err != nil {
+				lastErr = err.Error()
+				continue
+			}
+		case <-deadline.C:
+			mp.statusLock.Lock()
+			if mp.state != NeoStarting || mp.stopRequested {
+				mp.statusLock.Unlock()
+				return
+			}
+			// the exit of the process ends the run in failed with the reason
+			mp.reason = fmt.Sprintf("not ready within %s, %s", timeout, lastErr)
+			mp.statusLock.Unlock()
+			mp.log(fmt.Sprintf("%s is not ready within %s (%s), stopping...", mp.name, timeout, lastErr))
+			mp.Stop()
+			return
+		}
+		mp.becomeReady(exitC)
+		return
+	}
+}
+
+// becomeReady turns the process to running, starts the dependents and runs onReady until exit
+func (mp *ManagedProcess) becomeReady(exitC <-chan struct{}) {
+	if !mp.setReady() {
+		return
+	}
+	mp.startDependents()
+	if mp.onReady != nil {
+		mp.onReady(exitC)
+	}
+}
+
+func (mp *ManagedProcess) setReady() bool {
+	mp.statusLock.Lock()
+	if mp.state != NeoStarting || mp.stopRequested {
+		// being stopped while starting
+		mp.statusLock.Unlock()
+		return false
+	}
+	mp.ready = true
+	mp.statusLock.Unlock()
+	mp.setState(NeoRunning)
+	return true
+}
+
+// notifyReady is called when the process sends the ready message over navelcord
+func (mp *ManagedProcess) notifyReady() {
+	mp.statusLock.Lock()
+	defer mp.statusLock.Unlock()
+	if mp.readyC != nil {
+		close(mp.readyC)
+		mp.readyC = nil
+	}
+}
+
+// nextRestart returns the delay before relaunching the process that exited without Stop,
+// or false if the restart policy does not allow it.
+func (mp *ManagedProcess) nextRestart(failed bool, uptime time.Duration) (time.Duration, bool) {
+	if mp.restartPolicy == nil {
+		return 0, false
+	}
+	opts := mp.restartPolicy()
+	switch opts.Policy {
+	case RestartAlways:
+	case RestartOnFailure:
+		if !failed {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultRestartMaxRetries
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultRestartBackoff
+	}
+	if opts.BackoffMax < opts.Backoff {
+		opts.BackoffMax = max(defaultRestartBackoffMax, opts.Backoff)
+	}
+
+	mp.statusLock.Lock()
+	defer mp.statusLock.Unlock()
+	if uptime > opts.BackoffMax {
+		// the process was up long enough, it is not a crash loop
+		mp.failures = 0
+	}
+	if opts.MaxRetries > 0 && mp.failures >= opts.MaxRetries {
+		mp.log(fmt.Sprintf("Restart given up after %d retries (%s)", mp.failures, mp.lastExit))
+		return 0, false
+	}
+	delay := opts.Backoff
+	for i := 0; i < mp.failures && delay < opts.BackoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, opts.BackoffMax)
+	mp.failures++
+	return delay, true
+}
+
+func (mp *ManagedProcess) restartAfter(delay time.Duration) {
+	cancel := make(chan struct{})
+	mp.statusLock.Lock()
+	if mp.stopRequested {
+		mp.statusLock.Unlock()
+		mp.finish(NeoStopped)
+		return
+	}
+	mp.restartCancel = cancel
+	mp.statusLock.Unlock()
+
+	mp.setState(NeoRestarting)
+	mp.log(fmt.Sprintf("%s exited unexpectedly (%s), restarting in %s...", mp.name, mp.Status().LastExit, delay))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-cancel:
+	}
+
+	mp.statusLock.Lock()
+	mp.restartCancel = nil
+	canceled := mp.stopRequested
+	if !canceled {
+		mp.restarts++
+	}
+	mp.statusLock.Unlock()
+	if canceled {
+		mp.finish(NeoStopped)
+		return
+	}
+	mp.start(true)
+}
+
+// Stop stops the process in stages and returns after the final state.
+// It asks the process to stop first if requestStop is set, then sends a terminate signal to the process group,
+// and finally kills the process group if it still does not exit within the grace period.
+// The pending restart is canceled.
+func (mp *ManagedProcess) Stop() {
+	mp.statusLock.Lock()
+	mp.stopRequested = true
+	exited := mp.done
+	if mp.restartCancel != nil {
+		close(mp.restartCancel)
+		mp.restartCancel = nil
+	}
+	mp.statusLock.Unlock()
+
+	if exited == nil {
+		mp.setState(NeoStopped)
+		return
+	}
+	proc := mp.runningProcess()
+	if proc == nil {
+		// waiting for the next restart, or being launched that terminates itself on stopRequested
+		<-exited
+		return
+	}
+	timeout := defaultStopTimeout
+	if mp.stopTimeout != nil {
+		if d := mp.stopTimeout(); d > 0 {
+			timeout = d
+		}
+	}
+
+	mp.setState(NeoStopping)
+	mp.stopDependents()
+	if mp.requestStop != nil {
+		mp.log(fmt.Sprintf("Requesting %s to shutdown...", mp.name))
+		mp.requestStop(timeout)
+		if waitExit(exited, timeout) {
+			return
+		}
+		mp.setState(NeoTerminating)
+		mp.log(fmt.Sprintf("%s did not stop within %s, sending terminate signal...", mp.name, timeout))
+	}
+	if err := terminateProcess(proc); err != nil {
+		mp.log(fmt.Sprintf("Terminate failed %s", err.Error()))
+	}
+	if waitExit(exited, timeout) {
+		return
+	}
+
+	mp.setState(NeoKilling)
+	mp.log(fmt.Sprintf("%s did not terminate within %s, killing process...", mp.name, timeout))
+	if err := killProcess(proc); err != nil {
+		mp.log(fmt.Sprintf("Kill failed %s", err.Error()))
+	}
+	<-exited
+}
+
+// Kill kills the process group immediately, the restart policy applies as if the process crashed
+func (mp *ManagedProcess) Kill() error {
+	proc := mp.runningProcess()
+	if proc == nil {
+		return errors.New("not running")
+	}
+	return killProcess(proc)
+}
+
+// Restart stops the process and launches it again
+func (mp *ManagedProcess) Restart() error {
+	mp.Stop()
+	return mp.Start()
+}
+
+// AddDependent makes d follow the lifecycle of the process
+func (mp *ManagedProcess) AddDependent(d Dependent) {
+	mp.dependentsLock.Lock()
+	defer mp.dependentsLock.Unlock()
+	mp.dependents = append(mp.dependents, d)
+}
+
+func (mp *ManagedProcess) startDependents() {
+	mp.dependentsLock.Lock()
+	deps := slices.Clone(mp.dependents)
+	mp.dependentsLock.Unlock()
+	for _, d := range deps {
+		d.StartDependent()
+	}
+}
+
+// stopDependents stops the dependents in the reverse order of starting
+func (mp *ManagedProcess) stopDependents() {
+	mp.dependentsLock.Lock()
+	deps := slices.Clone(mp.dependents)
+	mp.dependentsLock.Unlock()
+	for i := len(deps) - 1; i >= 0; i-- {
+		deps[i].StopDependent()
+	}
+}
+
+func waitExit(exited <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-exited:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// openNavelcord registers the process to the navelcord server
+func (mp *ManagedProcess) openNavelcord() {
+	if mp.navelServer == nil {
+		srv, err := NewNavelServer(NavelTransportTCP, func(msg string) { mp.log(msg) })
+		if err != nil {
+			mp.log("navelcord disabled, " + err.Error())
+			return
+		}
+		mp.navelServer, mp.ownNavelServer = srv, true
+	}
+	mp.navel = mp.navelServer.Register(mp.name, NavelHandler{
+		OnMessage: mp.dispatchNavel,
+		Log:       func(msg string) { mp.log(msg) },
+	})
+}
+
+// dispatchNavel acks the heartbeats and handles the ready message, onNavel receives the others.
+// The heartbeat is passed to onNavel with the ack before it is sent back.
+func (mp *ManagedProcess) dispatchNavel(msg NavelMessage) error {
+	switch m := msg.(type) {
+	case *Heartbeat:
+		m.Ack = time.Now().UnixNano()
+		if mp.onNavel != nil {
+			if err := mp.onNavel(m); err != nil {
+				return err
+			}
+		}
+		return mp.sendNavel(m)
+	case *NavelReady:
+		mp.notifyReady()
+		return nil
+	}
+	if mp.onNavel != nil {
+		return mp.onNavel(msg)
+	}
+	return nil
+}
+
+// sendNavel writes the message to the process over navelcord
+func (mp *ManagedProcess) sendNavel(msg NavelMessage) error {
+	if mp.navel == nil {
+		return errors.New("navelcord is not enabled")
+	}
+	return mp.navel.Send(msg)
+}
+
+// negotiatedNavelVersion returns the protocol version agreed by hello, 0 if the process is not connected
+func (mp *ManagedProcess) negotiatedNavelVersion() int {
+	if mp.navel == nil {
+		return 0
+	}
+	return mp.navel.Version()
+}
+
+func (mp *ManagedProcess) log(msg string, args ...any) {
+	if mp.logWriter != nil {
+		fmt.Fprintln(mp.logWriter, append([]any{msg}, args...)...)
+	}
+}
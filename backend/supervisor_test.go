@@ -0,0 +1,300 @@
+package backend
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestProcess supervises the command, the states go to the returned channel
+func newTestProcess(t *testing.T, name string, args ...string) (*ManagedProcess, <-chan NeoStatus) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the test children are unix commands")
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s is not available", name)
+	}
+	states := make(chan NeoStatus, 100)
+	mp := newManagedProcess(name)
+	mp.command = func() (*exec.Cmd, error) { return exec.Command(name, args...), nil }
+	mp.stateCallback = func(st NeoStatus) { states <- st }
+	mp.Open()
+	t.Cleanup(func() {
+		mp.Stop()
+		mp.Close()
+	})
+	waitState(t, states, NeoStopped)
+	return mp, states
+}
+
+// waitState returns the states until the wanted one
+func waitState(t *testing.T, states <-chan NeoStatus, want NeoState) []NeoState {
+	t.Helper()
+	seen := []NeoState{}
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case st := <-states:
+			seen = append(seen, st.State)
+			if st.State == want {
+				return seen
+			}
+		case <-timeout:
+			t.Fatalf("no %s state, got %v", want, seen)
+		}
+	}
+}
+
+func TestManagedProcessStartStop(t *testing.T) {
+	mp, states := newTestProcess(t, "sleep", "30")
+	if err := mp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if got := waitState(t, states, NeoRunning); !slices.Equal(got, []NeoState{NeoStarting, NeoRunning}) {
+		t.Fatalf("states %v", got)
+	}
+	if mp.Pid() == 0 || !mp.IsReady() {
+		t.Fatalf("pid %d ready %v", mp.Pid(), mp.IsReady())
+	}
+	if err := mp.Start(); err == nil {
+		t.Fatal("started twice")
+	}
+	mp.Stop()
+	if got := waitState(t, states, NeoStopped); !slices.Equal(got, []NeoState{NeoStopping, NeoStopped}) {
+		t.Fatalf("states %v", got)
+	}
+	if st := mp.Status(); st.Pid != 0 || st.Reason != "" {
+		t.Fatalf("status after stop %+v", st)
+	}
+}
+
+func TestManagedProcessReadyCheck(t *testing.T) {
+	mp, states := newTestProcess(t, "sleep", "30")
+	var ready atomic.Bool
+	mp.readyCheck = func() error {
+		if !ready.Load() {
+			return errors.New("not yet")
+		}
+		return nil
+	}
+	if err := mp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, states, NeoStarting)
+	time.Sleep(600 * time.Millisecond)
+	if mp.IsReady() || mp.Status().State != NeoStarting {
+		t.Fatalf("ready before the check passes, %+v", mp.Status())
+	}
+	ready.Store(true)
+	waitState(t, states, NeoRunning)
+}
+
+func TestManagedProcessReadyTimeout(t *testing.T) {
+	mp, states := newTestProcess(t, "sleep", "30")
+	mp.readyCheck = func() error { return errors.New("no response") }
+	mp.readyTimeout = func() time.Duration { return 300 * time.Millisecond }
+	if err := mp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// stopped on the timeout, failed is the final state
+	if got := waitState(t, states, NeoFailed); !slices.Equal(got, []NeoState{NeoStarting, NeoStopping, NeoFailed}) {
+		t.Fatalf("states %v", got)
+	}
+	if st := mp.Status(); st.Pid != 0 || !strings.Contains(st.Reason, "not ready within") {
+		t.Fatalf("status after ready timeout %+v", st)
+	}
+}
+
+func TestManagedProcessStopStages(t *testing.T) {
+	// the child and its sleep ignore the terminate signal, only kill stops them
+	mp, states := newTestProcess(t, "sh", "-c", `trap "" TERM; sleep 30`)
+	var requested atomic.Int32
+	mp.requestStop = func(time.Duration) { requested.Add(1) }
+	mp.stopTimeout = func() time.Duration { return 200 * time.Millisecond }
+	if err := mp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, states, NeoRunning)
+	mp.Stop()
+	want := []NeoState{NeoStopping, NeoTerminating, NeoKilling, NeoStopped}
+	if got := waitState(t, states, NeoStopped); !slices.Equal(got, want) {
+		t.Fatalf("states %v, expected %v", got, want)
+	}
+	if requested.Load() != 1 {
+		t.Fatalf("stop requested %d times", requested.Load())
+	}
+}
+
+func TestManagedProcessRestartBackoff(t *testing.T) {
+	mp, states := newTestProcess(t, "false")
+	mp.restartPolicy = func() RestartOptions {
+		return RestartOptions{Policy: RestartOnFailure, MaxRetries: 2, Backoff: 50 * time.Millisecond, BackoffMax: 80 * time.Millisecond}
+	}
+	if err := mp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	got := waitState(t, states, NeoFailed)
+	restarting := 0
+	for _, st := range got {
+		if st == NeoRestarting {
+			restarting++
+		}
+	}
+	if restarting != 2 {
+		t.Fatalf("restarted %d times, states %v", restarting, got)
+	}
+	if st := mp.Status(); st.Restarts != 2 || !strings.Contains(st.Reason, "exited") {
+		t.Fatalf("status after giving up %+v", st)
+	}
+}
+
+func TestManagedProcessLaunchFailure(t *testing.T) {
+	mp, states := newTestProcess(t, "true")
+	mp.command = func() (*exec.Cmd, error) { return exec.Command("/nonexistent/machbase-neo"), nil }
+	if err := mp.Start(); err == nil {
+		t.Fatal("launched the missing binary")
+	}
+	if got := waitState(t, states, NeoFailed); !slices.Equal(got, []NeoState{NeoStarting, NeoFailed}) {
+		t.Fatalf("states %v", got)
+	}
+	if st := mp.Status(); !strings.Contains(st.Reason, "no such file") {
+		t.Fatalf("status after launch failure %+v", st)
+	}
+}
+
+func TestManagedProcessRelaunchFailure(t *testing.T) {
+	mp, states := newTestProcess(t, "false")
+	mp.restartPolicy = func() RestartOptions {
+		return RestartOptions{Policy: RestartOnFailure, MaxRetries: 2, Backoff: 50 * time.Millisecond, BackoffMax: 80 * time.Millisecond}
+	}
+	// the binary is gone after the first launch, the restart policy retries the launch
+	var launched atomic.Bool
+	mp.command = func() (*exec.Cmd, error) {
+		if launched.Swap(true) {
+			return exec.Command("/nonexistent/machbase-neo"), nil
+		}
+		return exec.Command("false"), nil
+	}
+	if err := mp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// false can exit before it turns to running
+	got := slices.DeleteFunc(waitState(t, states, NeoFailed), func(st NeoState) bool { return st == NeoRunning })
+	want := []NeoState{NeoStarting, NeoRestarting, NeoStarting, NeoRestarting, NeoStarting, NeoFailed}
+	if !slices.Equal(got, want) {
+		t.Fatalf("states %v, expected %v", got, want)
+	}
+	if st := mp.Status(); st.Restarts != 2 || !strings.Contains(st.Reason, "no such file") {
+		t.Fatalf("status after giving up %+v", st)
+	}
+}
+
+func TestManagedProcessNextRestart(t *testing.T) {
+	mp := newManagedProcess("test")
+	mp.restartPolicy = func() RestartOptions {
+		return RestartOptions{Policy: RestartOnFailure, MaxRetries: 5, Backoff: time.Second, BackoffMax: 5 * time.Second}
+	}
+	if _, ok := mp.nextRestart(false, 0); ok {
+		t.Fatal("on-failure restarts the process exited normally")
+	}
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay, ok := mp.nextRestart(true, time.Millisecond); !ok || delay != want {
+			t.Fatalf("restart %d delay %s %v, expected %s", i, delay, ok, want)
+		}
+	}
+	if _, ok := mp.nextRestart(true, time.Millisecond); ok {
+		t.Fatal("restarted after the max retries")
+	}
+	if delay, ok := mp.nextRestart(true, time.Minute); !ok || delay != time.Second {
+		t.Fatalf("the backoff is not reset after a long uptime, %s %v", delay, ok)
+	}
+}
+
+func TestManagedProcessStopCancelsRestart(t *testing.T) {
+	mp, states := newTestProcess(t, "false")
+	mp.restartPolicy = func() RestartOptions {
+		return RestartOptions{Policy: RestartAlways, Backoff: time.Minute}
+	}
+	if err := mp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, states, NeoRestarting)
+	if err := mp.Start(); err == nil {
+		t.Fatal("started while waiting for the restart")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		mp.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop waits for the backoff")
+	}
+	waitState(t, states, NeoStopped)
+	if st := mp.Status(); st.Restarts != 0 || st.State != NeoStopped {
+		t.Fatalf("status after cancel %+v", st)
+	}
+	mp.command = func() (*exec.Cmd, error) { return exec.Command("sleep", "30"), nil }
+	if err := mp.Start(); err != nil {
+		t.Fatalf("start after cancel, %s", err.Error())
+	}
+	waitState(t, states, NeoRunning)
+}
+
+// testDependents records the calls of the dependents in order
+type testDependents struct {
+	lock   sync.Mutex
+	events []string
+}
+
+type testDependent struct {
+	name string
+	rec  *testDependents
+}
+
+func (d *testDependent) StartDependent() { d.rec.record("start " + d.name) }
+func (d *testDependent) StopDependent()  { d.rec.record("stop " + d.name) }
+
+func (r *testDependents) record(ev string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, ev)
+}
+
+func (r *testDependents) snapshot() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return slices.Clone(r.events)
+}
+
+func TestManagedProcessDependents(t *testing.T) {
+	mp, states := newTestProcess(t, "sleep", "30")
+	rec := &testDependents{}
+	mp.AddDependent(&testDependent{name: "a", rec: rec})
+	mp.AddDependent(&testDependent{name: "b", rec: rec})
+	if err := mp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, states, NeoRunning)
+	time.Sleep(100 * time.Millisecond)
+	if got := rec.snapshot(); !slices.Equal(got, []string{"start a", "start b"}) {
+		t.Fatalf("after ready %v", got)
+	}
+	// exits without Stop, the dependents stop in the reverse order
+	if err := mp.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, states, NeoFailed)
+	if got := rec.snapshot(); !slices.Equal(got, []string{"start a", "start b", "stop b", "stop a"}) {
+		t.Fatalf("after exit %v", got)
+	}
+}
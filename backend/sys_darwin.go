@@ -0,0 +1,40 @@
+//go:build darwin
+
+package backend
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+const navelPeerPidSupported = true
+
+// SOL_LOCAL and LOCAL_PEERPID of sys/un.h, the syscall package does not have them
+const (
+	solLocal     = 0
+	localPeerPid = 0x002
+)
+
+// navelPeerPid returns the pid of the peer of the unix domain socket by LOCAL_PEERPID
+func navelPeerPid(conn net.Conn) (int, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var pid int
+	var pidErr error
+	if err := raw.Control(func(fd uintptr) {
+		pid, pidErr = syscall.GetsockoptInt(int(fd), solLocal, localPeerPid)
+	}); err != nil {
+		return 0, err
+	}
+	if pidErr != nil {
+		return 0, pidErr
+	}
+	return pid, nil
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package backend
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+const navelPeerPidSupported = true
+
+// navelPeerPid returns the pid of the peer of the unix domain socket by SO_PEERCRED
+func navelPeerPid(conn net.Conn) (int, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, credErr
+	}
+	return int(cred.Pid), nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package backend
+
+import (
+	"errors"
+	"net"
+)
+
+const navelPeerPidSupported = false
+
+// navelPeerPid is not supported, the connection without token is always rejected
+func navelPeerPid(conn net.Conn) (int, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -3,10 +3,135 @@
 package backend
 
 import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
 func sysProcAttr(cmd *exec.Cmd) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
+
+// terminateProcess sends SIGTERM to the process group created by sysProcAttr
+func terminateProcess(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGTERM)
+}
+
+// killProcess sends SIGKILL to the process group created by sysProcAttr
+func killProcess(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
+
+// interruptProcess asks the process to stop gracefully
+func interruptProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// portOwner returns the process that listens on the tcp port, pid is 0 if it can not be identified
+func portOwner(port int) (pid int, name string) {
+	if runtime.GOOS == "linux" {
+		return procPortOwner(port)
+	}
+	// e.g.
+	//  p1234
+	//  cmachbase-neo
+	out, err := runHelper("lsof", "-nP", fmt.Sprintf("-iTCP:%d", port), "-sTCP:LISTEN", "-Fpc")
+	if err != nil {
+		return 0, ""
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "p") && pid == 0 {
+			pid, _ = strconv.Atoi(line[1:])
+		} else if strings.HasPrefix(line, "c") && name == "" {
+			name = strings.TrimSpace(line[1:])
+		}
+	}
+	return
+}
+
+// procPortOwner finds the inode of the listening socket in /proc/net/tcp[6],
+// then the process that has the socket open. The processes of other users are not visible.
+func procPortOwner(port int) (int, string) {
+	inodes := map[string]bool{}
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		fd, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 || fields[3] != "0A" { // 0A: TCP_LISTEN
+				continue
+			}
+			_, hexPort, ok := strings.Cut(fields[1], ":")
+			if p, err := strconv.ParseInt(hexPort, 16, 32); !ok || err != nil || int(p) != port {
+				continue
+			}
+			inodes["socket:["+fields[9]+"]"] = true
+		}
+		fd.Close()
+	}
+	if len(inodes) == 0 {
+		return 0, ""
+	}
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if link, err := os.Readlink(fd); err != nil || !inodes[link] {
+			continue
+		}
+		pid, _ := strconv.Atoi(strings.Split(fd, "/")[2])
+		comm, _ := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+		return pid, strings.TrimSpace(string(comm))
+	}
+	return 0, ""
+}
+
+// navelSocketPathMax is the limit of the path of a unix domain socket, sun_path is 104 bytes on darwin
+const navelSocketPathMax = 100
+
+// listenNavelUnix listens on a unix domain socket in a private directory that only the user can access.
+// It returns the path of the socket, cleanup removes the directory after the listener is closed.
+func listenNavelUnix() (net.Listener, string, func(), error) {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if base == "" {
+		base = os.TempDir()
+	}
+	dir, err := os.MkdirTemp(base, "neo-launcher-")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	path := filepath.Join(dir, "navelcord.sock")
+	if len(path) > navelSocketPathMax {
+		cleanup()
+		return nil, "", nil, fmt.Errorf("socket path is too long, %s", path)
+	}
+	lsnr, err := net.Listen("unix", path)
+	if err != nil {
+		cleanup()
+		return nil, "", nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		lsnr.Close()
+		cleanup()
+		return nil, "", nil, err
+	}
+	return lsnr, path, cleanup, nil
+}
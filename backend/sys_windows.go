@@ -3,10 +3,95 @@
 package backend
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
 func sysProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow:    true,
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+var procGenerateConsoleCtrlEvent = syscall.NewLazyDLL("kernel32.dll").NewProc("GenerateConsoleCtrlEvent")
+
+// terminateProcess sends CTRL_BREAK to the process group created by sysProcAttr
+func terminateProcess(p *os.Process) error {
+	r, _, err := procGenerateConsoleCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(p.Pid))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// killProcess kills the whole process tree, since the server runs under cmd.exe
+func killProcess(p *os.Process) error {
+	cmd := exec.Command("taskkill", "/T", "/F", "/PID", fmt.Sprintf("%d", p.Pid))
 	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	if err := cmd.Run(); err != nil {
+		return p.Kill()
+	}
+	return nil
+}
+
+// interruptProcess is not supported, windows has no way to signal a GUI process.
+// The headless launcher is stopped by the stop file instead, see headless.stop().
+func interruptProcess(p *os.Process) error {
+	return errors.ErrUnsupported
+}
+
+func processAlive(pid int) bool {
+	const PROCESS_QUERY_LIMITED_INFORMATION = 0x1000
+	const STILL_ACTIVE = 259
+	h, err := syscall.OpenProcess(PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == STILL_ACTIVE
+}
+
+// portOwner returns the process that listens on the tcp port, pid is 0 if it can not be identified
+func portOwner(port int) (pid int, name string) {
+	// e.g.
+	//  TCP    0.0.0.0:5654           0.0.0.0:0              LISTENING       1234
+	out, err := runHelper("netstat", "-ano", "-p", "TCP")
+	if err != nil {
+		return 0, ""
+	}
+	suffix := fmt.Sprintf(":%d", port)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		// the state column is localized, a listening socket has no foreign port
+		if len(fields) < 5 || !strings.HasSuffix(fields[1], suffix) || !strings.HasSuffix(fields[2], ":0") {
+			continue
+		}
+		pid, _ = strconv.Atoi(fields[4])
+		break
+	}
+	if pid == 0 {
+		return 0, ""
+	}
+	// e.g. "machbase-neo.exe","1234","Console","1","120,000 K"
+	out, err = runHelper("tasklist", "/FI", fmt.Sprintf("PID eq %d", pid), "/FO", "CSV", "/NH")
+	if err == nil && strings.HasPrefix(out, `"`) {
+		name, _, _ = strings.Cut(strings.TrimPrefix(out, `"`), `"`)
+	}
+	return pid, name
+}
+
+// listenNavelUnix is not supported on windows, the navelcord stays on tcp
+func listenNavelUnix() (net.Listener, string, func(), error) {
+	return nil, "", nil, errors.New("unix domain socket is not supported on windows")
 }
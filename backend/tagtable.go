@@ -0,0 +1,198 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ColumnMismatch is a column of the tag table that neocat can not write into
+type ColumnMismatch struct {
+	Column   int    `json:"column"` // 0-based position in the table
+	Name     string `json:"name,omitempty"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+func (c ColumnMismatch) String() string {
+	return fmt.Sprintf("column %d %s is %s, expected %s", c.Column, c.Name, c.Actual, c.Expected)
+}
+
+// machbase column types of M$SYS_COLUMNS
+const (
+	machTypeShort    = 4
+	machTypeVarchar  = 5
+	machTypeDatetime = 6
+	machTypeInteger  = 8
+	machTypeLong     = 12
+	machTypeFloat    = 16
+	machTypeDouble   = 20
+	machTableTag     = 6 // TYPE of M$SYS_TABLES
+)
+
+var machTypeNames = map[int]string{
+	machTypeShort:    "short",
+	machTypeVarchar:  "varchar",
+	machTypeDatetime: "datetime",
+	machTypeInteger:  "integer",
+	machTypeLong:     "long",
+	machTypeFloat:    "float",
+	machTypeDouble:   "double",
+}
+
+func machTypeName(typ int) string {
+	if name, ok := machTypeNames[typ]; ok {
+		return name
+	}
+	return fmt.Sprintf("type %d", typ)
+}
+
+// tagColumns are what neocat writes, the name of the tag, the time and the value in order.
+// The value can be any numeric type.
+var tagColumns = []struct {
+	expected string
+	accept   func(int) bool
+}{
+	{"varchar", func(t int) bool { return t == machTypeVarchar }},
+	{"datetime", func(t int) bool { return t == machTypeDatetime }},
+	{"numeric", func(t int) bool {
+		switch t {
+		case machTypeShort, machTypeInteger, machTypeLong, machTypeFloat, machTypeDouble:
+			return true
+		}
+		return false
+	}},
+}
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// tagTableTimeout limits every query of the table check
+const tagTableTimeout = 5 * time.Second
+
+// checkTagTable verifies that the table exists and neocat can append to it.
+// It returns *LaunchError for the missing table and the incompatible columns.
+func checkTagTable(target NeoCatTarget, table string) error {
+	if !tableNamePattern.MatchString(table) {
+		return fmt.Errorf("invalid table name %q", table)
+	}
+	table = strings.ToUpper(table)
+	rows, err := queryServer(target, fmt.Sprintf("SELECT ID, TYPE FROM M$SYS_TABLES WHERE NAME = '%s'", table))
+	if err != nil {
+		return fmt.Errorf("can not check the table %s, %s", table, err.Error())
+	}
+	if len(rows) == 0 {
+		return &LaunchError{
+			Reason:  LaunchErrorTableMissing,
+			Message: fmt.Sprintf("table %s does not exist", table),
+			Table:   table,
+		}
+	}
+	id, typ := toInt(rows[0][0]), toInt(rows[0][1])
+	if typ != machTableTag {
+		return &LaunchError{
+			Reason:  LaunchErrorTableSchema,
+			Message: fmt.Sprintf("table %s is not a tag table", table),
+			Table:   table,
+		}
+	}
+	rows, err = queryServer(target, fmt.Sprintf("SELECT NAME, TYPE FROM M$SYS_COLUMNS WHERE TABLE_ID = %d ORDER BY ID", id))
+	if err != nil {
+		return fmt.Errorf("can not check the columns of %s, %s", table, err.Error())
+	}
+	columns := [][]any{}
+	for _, row := range rows {
+		// skip the hidden columns, e.g. _RID
+		if name, _ := row[0].(string); !strings.HasPrefix(name, "_") {
+			columns = append(columns, row)
+		}
+	}
+	mismatches := []ColumnMismatch{}
+	for i, expect := range tagColumns {
+		if i >= len(columns) {
+			mismatches = append(mismatches, ColumnMismatch{Column: i, Expected: expect.expected, Actual: "missing"})
+			continue
+		}
+		name, _ := columns[i][0].(string)
+		typ := toInt(columns[i][1])
+		if !expect.accept(typ) {
+			mismatches = append(mismatches, ColumnMismatch{Column: i, Name: name, Expected: expect.expected, Actual: machTypeName(typ)})
+		}
+	}
+	if len(mismatches) > 0 {
+		return &LaunchError{
+			Reason:  LaunchErrorTableSchema,
+			Message: fmt.Sprintf("table %s does not fit neocat", table),
+			Table:   table,
+			Columns: mismatches,
+		}
+	}
+	return nil
+}
+
+// createTagTable creates the tag table with the columns that neocat writes
+func createTagTable(target NeoCatTarget, table string) error {
+	if !tableNamePattern.MatchString(table) {
+		return fmt.Errorf("invalid table name %q", table)
+	}
+	_, err := queryServer(target, fmt.Sprintf(
+		"CREATE TAG TABLE IF NOT EXISTS %s (NAME VARCHAR(100) PRIMARY KEY, TIME DATETIME BASETIME, VALUE DOUBLE SUMMARIZED)",
+		strings.ToUpper(table)))
+	return err
+}
+
+// queryServer runs the sql over the HTTP API of the server and returns the rows
+func queryServer(target NeoCatTarget, sql string) ([][]any, error) {
+	u := url.URL{
+		Scheme:   "http",
+		Host:     net.JoinHostPort(target.Host, target.Ports["http-port"]),
+		Path:     "/db/query",
+		RawQuery: url.Values{"q": {sql}}.Encode(),
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if target.HttpTokenAuth {
+		if target.Token == "" {
+			return nil, errors.New("the server requires a token")
+		}
+		req.Header.Set("Authorization", "Bearer "+target.Token)
+	}
+	client := &http.Client{Timeout: tagTableTimeout}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	result := struct {
+		Success bool   `json:"success"`
+		Reason  string `json:"reason"`
+		Data    struct {
+			Rows [][]any `json:"rows"`
+		} `json:"data"`
+	}{}
+	if err := json.NewDecoder(rsp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%s, %s", rsp.Status, err.Error())
+	}
+	if !result.Success {
+		return nil, errors.New(result.Reason)
+	}
+	return result.Data.Rows, nil
+}
+
+func toInt(v any) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case json.Number:
+		i, _ := n.Int64()
+		return int(i)
+	}
+	return 0
+}
@@ -80,11 +80,18 @@ const EVT_TERM = 'term';
 const EVT_LOG = 'log';
 const EVT_STATE = 'state';
 const EVT_FLAGS = 'flags';
+const EVT_ERROR = 'error';
+const EVT_HEALTH = 'health';
+const EVT_NEOCAT = 'neocat';
 
 const STATE_STARTING = 'starting';
 const STATE_RUNNING = 'running';
+const STATE_RESTARTING = 'restarting';
 const STATE_STOPPING = 'stopping';
+const STATE_TERMINATING = 'terminating';
+const STATE_KILLING = 'killing';
 const STATE_STOPPED = 'not running';
+const STATE_FAILED = 'failed';
 
 window.runtime.EventsOn(EVT_TERM, (data) => {
     if (data === '\\033c') {
@@ -102,9 +109,109 @@ window.runtime.EventsOn(EVT_FLAGS, (data) => {
 
     let launchCmdWithFlags = document.getElementById('launchCmdWithFlags');
     let fullCmd = data.binPath + ' serve ' + data.flags.join(' ');
+    let env = (data.unset || []).map((k) => '-u ' + k).concat(data.env || []);
+    if (env.length > 0) {
+        fullCmd = 'env ' + env.join(' ') + ' ' + fullCmd;
+    }
     launchCmdWithFlags.innerText = fullCmd;
+
+    // invalid or unsupported options
+    let errors = (data.errors || []).map(flagErrorText);
+    flags.title = errors.join('\n');
+    flags.style.color = errors.length > 0 ? 'var(--sl-color-danger-600)' : '';
+})
+function flagErrorText(e) {
+    return (e.warning ? 'ignored' : 'invalid') + (e.flag === 'env' ? ' env ' : ' --' + e.flag + ' ') + '"' + e.value + '", ' + e.message;
+}
+
+// the launcher refused to start the server
+window.runtime.EventsOn(EVT_ERROR, (err) => {
+    if (err.instance && activeInstance && err.instance !== activeInstance) {
+        return;
+    }
+    if (err.reason === 'table-missing' || err.reason === 'table-schema') {
+        showNeoCatTableError(err);
+        return;
+    }
+    if (err.reason !== 'port-conflict') {
+        term.write('\x1b[31m' + err.message + '\x1b[0m\r\n');
+        return;
+    }
+    const dialog = document.getElementById('portConflictDialog');
+    const list = document.getElementById('portConflicts');
+    list.innerHTML = '';
+    (err.conflicts || []).forEach((c) => {
+        let line = document.createElement('p');
+        line.innerText = '--' + c.flag + ' ' + c.addr + (c.pid ? ' is in use by ' + c.process + ' (pid: ' + c.pid + ')' : ', ' + c.error)
+            + (c.suggest ? ', suggested port ' + c.suggest : '');
+        list.appendChild(line);
+    });
+    const useSuggested = document.getElementById('useSuggestedPorts');
+    useSuggested.disabled = !(err.conflicts || []).some((c) => c.suggest);
+    useSuggested.onclick = () => {
+        App.DoGetLaunchOptions().then((options) => {
+            options.flags = options.flags || {};
+            (err.conflicts || []).filter((c) => c.suggest).forEach((c) => {
+                options.flags[c.flag] = String(c.suggest);
+            });
+            return App.DoSetLaunchOptions(options);
+        }).then(() => dialog.hide());
+    };
+    dialog.show();
+})
+
+// neocat refuses to start if its table is missing or does not fit, the missing table can be created here
+function showNeoCatTableError(err) {
+    const dialog = document.getElementById('neocatTableDialog');
+    const message = document.getElementById('neocatTableMessage');
+    message.innerHTML = '';
+    [err.message].concat((err.columns || []).map((c) =>
+        'column ' + c.column + ' ' + (c.name || '') + ' is ' + c.actual + ', expected ' + c.expected
+    )).forEach((text) => {
+        let line = document.createElement('p');
+        line.innerText = text;
+        message.appendChild(line);
+    });
+    const create = document.getElementById('createNeoCatTable');
+    create.disabled = err.reason !== 'table-missing';
+    create.onclick = () => {
+        App.DoCreateNeoCatTable(err.table).then(() => {
+            dialog.hide();
+            App.DoStartNeoCat();
+        }).catch((e) => {
+            term.write('\x1b[31m' + e + '\x1b[0m\r\n');
+        });
+    };
+    dialog.show();
+}
+
+// the result of the periodic health check of the running server
+window.runtime.EventsOn(EVT_HEALTH, (health) => {
+    if (health.instance && activeInstance && health.instance !== activeInstance) {
+        return;
+    }
+    const badge = document.getElementById('healthBadge');
+    badge.innerText = health.status;
+    badge.variant = health.status === 'up' ? 'success' : health.status === 'degraded' ? 'warning' : 'danger';
+    badge.title = 'http: ' + (health.httpError || health.httpMs.toFixed(1) + 'ms')
+        + '\ngrpc: ' + (health.grpcError || health.grpcMs.toFixed(1) + 'ms')
+        + (health.heartbeat ? '\nheartbeat: ' + health.heartbeat.lastMs.toFixed(1) + 'ms'
+            + ' (min/avg/max ' + [health.heartbeat.minMs, health.heartbeat.avgMs, health.heartbeat.maxMs].map((v) => v.toFixed(1)).join('/') + 'ms'
+            + ', ' + health.heartbeat.count + ' received' + (health.heartbeat.missed > 0 ? ', ' + health.heartbeat.missed + ' missed' : '') + ')' : '')
+        + (health.lastError ? '\nlast error: ' + health.lastError + ' (' + health.lastErrorAt + ')' : '')
+        + '\nchecked: ' + health.checkedAt;
+    badge.style.display = '';
 })
-window.runtime.EventsOn(EVT_STATE, (data) => {
+
+// the profile name of the instance that the terminal shows
+let activeInstance = '';
+App.DoGetActiveProfile().then((name) => { activeInstance = name; });
+
+window.runtime.EventsOn(EVT_STATE, (status) => {
+    if (status.instance && activeInstance && status.instance !== activeInstance) {
+        return;
+    }
+    let data = status.state;
     let launchButton = document.getElementById('launchButton');
     let launchIcon = document.getElementById('launchIcon');
     let launchText = document.getElementById('launchText');
@@ -114,7 +221,24 @@ window.runtime.EventsOn(EVT_STATE, (data) => {
     let openBrowserButton = document.getElementById('openBrowserButton');
     switch (data) {
         case STATE_STARTING:
-            launchButton.disabled = true;
+            // not ready yet, allow to stop the server that does not come up
+            launchText.innerText = 'Stop machbase-neo'
+            launchIcon.setAttribute('name', 'sign-stop')
+            launchButton.setAttribute('onclick', 'appStopServer()');
+            launchButton.setAttribute('variant', 'danger');
+            launchButton.disabled = false;
+            openBrowserButton.disabled = true;
+            stateButton.disabled = true;
+            stateButton.setAttribute('variant', 'warning');
+            stateIcon.setAttribute('name', 'dash-circle')
+            break;
+        case STATE_RESTARTING:
+            // allow to cancel the pending restart
+            launchText.innerText = 'Stop machbase-neo'
+            launchIcon.setAttribute('name', 'sign-stop')
+            launchButton.setAttribute('onclick', 'appStopServer()');
+            launchButton.setAttribute('variant', 'danger');
+            launchButton.disabled = false;
             openBrowserButton.disabled = true;
             stateButton.disabled = true;
             stateButton.setAttribute('variant', 'warning');
@@ -132,6 +256,8 @@ window.runtime.EventsOn(EVT_STATE, (data) => {
             openBrowserButton.disabled = false;
             break;
         case STATE_STOPPING:
+        case STATE_TERMINATING:
+        case STATE_KILLING:
             launchButton.disabled = true;
             openBrowserButton.disabled = true;
             stateButton.disabled = true;
@@ -149,11 +275,32 @@ window.runtime.EventsOn(EVT_STATE, (data) => {
             stateButton.setAttribute('variant', 'neutral');
             stateIcon.setAttribute('name', 'dash-circle')
             break;
+        case STATE_FAILED:
+            launchText.innerText = 'machbase-neo serve'
+            launchIcon.setAttribute('name', 'rocket-takeoff')
+            launchButton.setAttribute('onclick', 'appStartServer()');
+            launchButton.setAttribute('variant', 'primary');
+            launchButton.disabled = false;
+            openBrowserButton.disabled = true;
+            stateButton.disabled = true;
+            stateButton.setAttribute('variant', 'danger');
+            stateIcon.setAttribute('name', 'x-square')
+            break;
         default:
             term.write('Unknown state: ' + data + '\r\n');
             break;
     }
+    if (data !== STATE_RUNNING) {
+        document.getElementById('healthBadge').style.display = 'none';
+    }
     stateText.innerText = data.toUpperCase();
+    if (status.restarts > 0) {
+        stateText.innerText += ' (restarts: ' + status.restarts + ')';
+    }
+    stateButton.title = status.lastExit ? 'last exit: ' + status.lastExit : '';
+    if (status.reason) {
+        stateButton.title = status.reason + (stateButton.title ? '\n' + stateButton.title : '');
+    }
 })
 
 // Expose the App.Version function to the window
@@ -193,6 +340,50 @@ window.appClearLog = function () {
     App.DoClearLog();
 };
 
+// pages through the kept lines of the log, from is the sequence number of the first line, 0 for the latest
+window.appGetLogLines = App.DoGetLogLines
+
+window.appShowLogSearch = function () {
+    document.getElementById('logSearchDrawer').show();
+    appSearchLog();
+};
+
+// searches the parsed records of the server log, the terminal keeps the raw output
+window.appSearchLog = function () {
+    const value = (id) => document.getElementById(id).value;
+    const filter = {
+        level: value('logSearchLevel'),
+        logger: value('logSearchLogger'),
+        text: value('logSearchText'),
+    };
+    if (value('logSearchSince')) {
+        filter.since = new Date(value('logSearchSince')).toISOString();
+    }
+    if (value('logSearchUntil')) {
+        filter.until = new Date(value('logSearchUntil')).toISOString();
+    }
+    App.DoQueryLog(filter).then((records) => {
+        const result = document.getElementById('logSearchResult');
+        result.innerHTML = '';
+        records.forEach((rec) => {
+            let line = document.createElement('div');
+            let fields = Object.entries(rec.fields || {}).map(([k, v]) => ' ' + k + '=' + v).join('');
+            line.innerText = rec.level
+                ? new Date(rec.time).toLocaleString() + ' ' + rec.level + ' ' + rec.logger + ' ' + rec.message + fields
+                : rec.message;
+            if (rec.level === 'WARN') {
+                line.style.color = 'var(--sl-color-warning-600)';
+            } else if (rec.level === 'ERROR' || rec.level === 'FATAL' || rec.level === 'PANIC') {
+                line.style.color = 'var(--sl-color-danger-600)';
+            }
+            result.appendChild(line);
+        });
+        if (records.length === 0) {
+            result.innerText = 'no matching records';
+        }
+    });
+};
+
 window.appSelectDirectory = function (input) {
     let cur = input.value;
     App.DoSelectDirectory(cur)
@@ -223,6 +414,16 @@ window.appSetNeoCatLauncher = App.DoSetNeoCatLauncher
 
 window.appStartNeoCatLauncher = App.DoStartNeoCat
 window.appStopNeoCatLauncher = App.DoStopNeoCat
+window.appGetNeoCatStatus = App.DoGetNeoCatStatus
+
+// the states of the neocat collectors by the name of the collector
+window.neocatStatus = {};
+window.runtime.EventsOn(EVT_NEOCAT, (status) => {
+    window.neocatStatus[status.instance] = status;
+    if (status.state === STATE_FAILED) {
+        term.write(status.instance + ' failed, ' + status.reason + '\r\n');
+    }
+})
 
 window.setTheme = function (newTheme) {
     const themeIcon = document.getElementById('themeIcon')
@@ -250,9 +451,81 @@ window.toggleTheme = function () {
     window.setTheme(newTheme);
 }
 
+// keeps the options that are not shown in the drawer
+let currentLaunchOptions = {};
+
+// flags that have their own input in the drawer
+const typedFlags = ['data', 'file', 'host', 'backup-dir', 'log-level', 'log-filename', 'http-debug',
+    'http-enable-token-auth', 'mqtt-enable-token-auth', 'mqtt-enable-tls', 'jwt-at-expire', 'jwt-rt-expire', 'experiment'];
+
+// renders inputs of the flags that come from the schema of 'machbase-neo serve'
+function renderSchemaFlags(values) {
+    const container = document.getElementById('schemaFlags');
+    App.DoGetFlagSchema().then((schema) => {
+        container.innerHTML = '';
+        schema.filter((spec) => !typedFlags.includes(spec.name)).forEach((spec) => {
+            let input = document.createElement('sl-input');
+            input.setAttribute('label', '--' + spec.name);
+            input.setAttribute('help-text', spec.description || '');
+            input.setAttribute('placeholder', spec.default || '');
+            input.setAttribute('clearable', '');
+            input.classList.add('label-on-left', 'label-adv', 'schema-flag');
+            input.dataset.flag = spec.name;
+            input.value = values && values[spec.name] ? values[spec.name] : '';
+            container.appendChild(input);
+            container.appendChild(document.createElement('br'));
+        });
+    });
+}
+
+// env overrides are edited as lines of KEY=VALUE, or -KEY to unset
+function formatEnv(env) {
+    return Object.keys(env || {}).sort().map((k) => env[k] === null ? '-' + k : k + '=' + env[k]).join('\n');
+}
+
+function parseEnv(text) {
+    let env = {};
+    text.split('\n').map((line) => line.trim()).filter((line) => line !== '').forEach((line) => {
+        if (line.startsWith('-')) {
+            env[line.substring(1)] = null;
+        } else {
+            let idx = line.indexOf('=');
+            env[idx < 0 ? line : line.substring(0, idx)] = idx < 0 ? '' : line.substring(idx + 1);
+        }
+    });
+    return env;
+}
+
+function collectSchemaFlags() {
+    let flags = {};
+    document.querySelectorAll('#schemaFlags .schema-flag').forEach((input) => {
+        if (input.value !== '') {
+            flags[input.dataset.flag] = input.value;
+        }
+    });
+    return flags;
+}
+
 window.onShowLauncherOptions = function () {
     const drawer = document.getElementById('drawer-options');
+    const profileSelect = document.getElementById('profileSelect');
+    Promise.all([App.DoGetProfiles(), App.DoGetActiveProfile()]).then(([profiles, active]) => {
+        profileSelect.innerHTML = '';
+        profiles.forEach((name) => {
+            let opt = document.createElement('sl-option');
+            opt.value = name;
+            opt.innerText = name;
+            profileSelect.appendChild(opt);
+        });
+        profileSelect.value = active;
+        profileSelect.removeEventListener('sl-change', onChangeProfile);
+        profileSelect.addEventListener('sl-change', onChangeProfile);
+    });
     App.DoGetLaunchOptions().then((options) => {
+        currentLaunchOptions = options;
+        renderSchemaFlags(options.flags);
+        document.getElementById('extraArgs').value = (options.extraArgs || []).join('\n');
+        document.getElementById('envOverrides').value = formatEnv(options.env);
         drawer.querySelectorAll(".item")
             .forEach((item) => {
                 switch (item.getAttribute('name')) {
@@ -303,9 +576,23 @@ window.onShowLauncherOptions = function () {
     });
 }
 
+function onChangeProfile(e) {
+    activeInstance = e.target.value;
+    App.DoActivateProfile(e.target.value)
+        .then(() => {
+            window.onShowLauncherOptions();
+        })
+        .catch((err) => {
+            term.write(err + '\r\n');
+            App.DoGetActiveProfile().then((name) => { activeInstance = name; });
+            window.onShowLauncherOptions();
+        });
+}
+
 window.onHideLauncherOptions = function () {
     const drawer = document.getElementById('drawer-options');
     let options = {
+        ...currentLaunchOptions,
         data: drawer.querySelector(".item[name='data']").value,
         file: drawer.querySelector(".item[name='file']").value,
         host: drawer.querySelector(".item[name='host']").value,
@@ -319,7 +606,15 @@ window.onHideLauncherOptions = function () {
         jwtAtExpire: drawer.querySelector(".item[name='jwt-at-expire']").value,
         jwtRtExpire: drawer.querySelector(".item[name='jwt-rt-expire']").value,
         experiment: drawer.querySelector(".item[name='experiment']").value == 'true',
+        flags: collectSchemaFlags(),
+        extraArgs: document.getElementById('extraArgs').value.split('\n').map((a) => a.trim()).filter((a) => a !== ''),
+        env: parseEnv(document.getElementById('envOverrides').value),
     };
+    App.DoValidateLaunchOptions(options).then((errs) => {
+        (errs || []).forEach((e) => {
+            term.write('\x1b[31m' + flagErrorText(e) + '\x1b[0m\r\n');
+        });
+    });
     App.DoSetLaunchOptions(options)
         .then(() => {
             drawer.hide()
@@ -3,22 +3,44 @@
 import {backend} from '../models';
 import {io} from '../models';
 
+export function DoActivateProfile(arg1:string):Promise<void>;
+
 export function DoClearLog():Promise<void>;
 
+export function DoCloneProfile(arg1:string,arg2:string):Promise<void>;
+
 export function DoCopyLog():Promise<void>;
 
+export function DoCreateNeoCatTable(arg1:string):Promise<void>;
+
+export function DoCreateProfile(arg1:string):Promise<void>;
+
+export function DoDeleteProfile(arg1:string):Promise<void>;
+
 export function DoFrontendReady():Promise<void>;
 
+export function DoGetActiveProfile():Promise<string>;
+
+export function DoGetFlagSchema():Promise<Array<backend.FlagSpec>>;
+
 export function DoGetFlags():Promise<void>;
 
+export function DoGetInstances():Promise<Array<backend.InstanceInfo>>;
+
 export function DoGetLaunchOptions():Promise<backend.LaunchOptions>;
 
+export function DoGetLogLines(arg1:number,arg2:number):Promise<backend.LogPage>;
+
 export function DoGetNeoCatLauncher():Promise<backend.NeoCatOptions>;
 
+export function DoGetNeoCatStatus():Promise<Array<backend.NeoStatus>>;
+
 export function DoGetOS():Promise<string>;
 
 export function DoGetProcessInfo():Promise<string>;
 
+export function DoGetProfiles():Promise<Array<string>>;
+
 export function DoGetRecentDirList():Promise<Array<string>>;
 
 export function DoGetRecentFileList():Promise<Array<string>>;
@@ -27,6 +49,10 @@ export function DoGetTheme():Promise<string>;
 
 export function DoOpenBrowser():Promise<void>;
 
+export function DoQueryLog(arg1:backend.LogFilter):Promise<Array<backend.LogRecord>>;
+
+export function DoRenameProfile(arg1:string,arg2:string):Promise<void>;
+
 export function DoRevealConfig():Promise<void>;
 
 export function DoRevealNeoBin():Promise<void>;
@@ -41,14 +67,20 @@ export function DoSetNeoCatLauncher(arg1:backend.NeoCatOptions):Promise<void>;
 
 export function DoSetTheme(arg1:string):Promise<void>;
 
+export function DoStartInstance(arg1:string):Promise<void>;
+
 export function DoStartNeoCat():Promise<void>;
 
 export function DoStartServer():Promise<void>;
 
+export function DoStopInstance(arg1:string):Promise<void>;
+
 export function DoStopNeoCat():Promise<void>;
 
 export function DoStopServer():Promise<void>;
 
+export function DoValidateLaunchOptions(arg1:backend.LaunchOptions):Promise<Array<backend.FlagError>>;
+
 export function DoVersion():Promise<void>;
 
 export function NewLogWriter():Promise<io.Writer>;
@@ -2,30 +2,70 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function DoActivateProfile(arg1) {
+  return window['go']['backend']['App']['DoActivateProfile'](arg1);
+}
+
 export function DoClearLog() {
   return window['go']['backend']['App']['DoClearLog']();
 }
 
+export function DoCloneProfile(arg1, arg2) {
+  return window['go']['backend']['App']['DoCloneProfile'](arg1, arg2);
+}
+
 export function DoCopyLog() {
   return window['go']['backend']['App']['DoCopyLog']();
 }
 
+export function DoCreateNeoCatTable(arg1) {
+  return window['go']['backend']['App']['DoCreateNeoCatTable'](arg1);
+}
+
+export function DoCreateProfile(arg1) {
+  return window['go']['backend']['App']['DoCreateProfile'](arg1);
+}
+
+export function DoDeleteProfile(arg1) {
+  return window['go']['backend']['App']['DoDeleteProfile'](arg1);
+}
+
 export function DoFrontendReady() {
   return window['go']['backend']['App']['DoFrontendReady']();
 }
 
+export function DoGetActiveProfile() {
+  return window['go']['backend']['App']['DoGetActiveProfile']();
+}
+
+export function DoGetFlagSchema() {
+  return window['go']['backend']['App']['DoGetFlagSchema']();
+}
+
 export function DoGetFlags() {
   return window['go']['backend']['App']['DoGetFlags']();
 }
 
+export function DoGetInstances() {
+  return window['go']['backend']['App']['DoGetInstances']();
+}
+
 export function DoGetLaunchOptions() {
   return window['go']['backend']['App']['DoGetLaunchOptions']();
 }
 
+export function DoGetLogLines(arg1, arg2) {
+  return window['go']['backend']['App']['DoGetLogLines'](arg1, arg2);
+}
+
 export function DoGetNeoCatLauncher() {
   return window['go']['backend']['App']['DoGetNeoCatLauncher']();
 }
 
+export function DoGetNeoCatStatus() {
+  return window['go']['backend']['App']['DoGetNeoCatStatus']();
+}
+
 export function DoGetOS() {
   return window['go']['backend']['App']['DoGetOS']();
 }
@@ -34,6 +74,10 @@ export function DoGetProcessInfo() {
   return window['go']['backend']['App']['DoGetProcessInfo']();
 }
 
+export function DoGetProfiles() {
+  return window['go']['backend']['App']['DoGetProfiles']();
+}
+
 export function DoGetRecentDirList() {
   return window['go']['backend']['App']['DoGetRecentDirList']();
 }
@@ -50,6 +94,14 @@ export function DoOpenBrowser() {
   return window['go']['backend']['App']['DoOpenBrowser']();
 }
 
+export function DoQueryLog(arg1) {
+  return window['go']['backend']['App']['DoQueryLog'](arg1);
+}
+
+export function DoRenameProfile(arg1, arg2) {
+  return window['go']['backend']['App']['DoRenameProfile'](arg1, arg2);
+}
+
 export function DoRevealConfig() {
   return window['go']['backend']['App']['DoRevealConfig']();
 }
@@ -78,6 +130,10 @@ export function DoSetTheme(arg1) {
   return window['go']['backend']['App']['DoSetTheme'](arg1);
 }
 
+export function DoStartInstance(arg1) {
+  return window['go']['backend']['App']['DoStartInstance'](arg1);
+}
+
 export function DoStartNeoCat() {
   return window['go']['backend']['App']['DoStartNeoCat']();
 }
@@ -86,6 +142,10 @@ export function DoStartServer() {
   return window['go']['backend']['App']['DoStartServer']();
 }
 
+export function DoStopInstance(arg1) {
+  return window['go']['backend']['App']['DoStopInstance'](arg1);
+}
+
 export function DoStopNeoCat() {
   return window['go']['backend']['App']['DoStopNeoCat']();
 }
@@ -94,6 +154,10 @@ export function DoStopServer() {
   return window['go']['backend']['App']['DoStopServer']();
 }
 
+export function DoValidateLaunchOptions(arg1) {
+  return window['go']['backend']['App']['DoValidateLaunchOptions'](arg1);
+}
+
 export function DoVersion() {
   return window['go']['backend']['App']['DoVersion']();
 }
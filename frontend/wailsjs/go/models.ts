@@ -1,5 +1,240 @@
 export namespace backend {
 	
+	export class FlagError {
+	    flag: string;
+	    value: string;
+	    message: string;
+	    warning?: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new FlagError(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.flag = source["flag"];
+	        this.value = source["value"];
+	        this.message = source["message"];
+	        this.warning = source["warning"];
+	    }
+	}
+	export class FlagSpec {
+	    name: string;
+	    type: string;
+	    default?: string;
+	    description?: string;
+	    enum?: string[];
+	    group?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FlagSpec(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.type = source["type"];
+	        this.default = source["default"];
+	        this.description = source["description"];
+	        this.enum = source["enum"];
+	        this.group = source["group"];
+	    }
+	}
+	export class NeoStatus {
+	    instance?: string;
+	    state: string;
+	    pid?: number;
+	    restarts: number;
+	    lastExit?: string;
+	    exitCode?: number;
+	    reason?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new NeoStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.instance = source["instance"];
+	        this.state = source["state"];
+	        this.pid = source["pid"];
+	        this.restarts = source["restarts"];
+	        this.lastExit = source["lastExit"];
+	        this.exitCode = source["exitCode"];
+	        this.reason = source["reason"];
+	    }
+	}
+	export class InstanceInfo {
+	    id: string;
+	    active: boolean;
+	    status: NeoStatus;
+	    ready: boolean;
+	    pid?: number;
+	    httpAddr?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new InstanceInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.active = source["active"];
+	        this.status = this.convertValues(source["status"], NeoStatus);
+	        this.ready = source["ready"];
+	        this.pid = source["pid"];
+	        this.httpAddr = source["httpAddr"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class LogFilter {
+	    level?: string;
+	    logger?: string;
+	    text?: string;
+	    // Go type: time
+	    since?: any;
+	    // Go type: time
+	    until?: any;
+	    limit?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new LogFilter(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.level = source["level"];
+	        this.logger = source["logger"];
+	        this.text = source["text"];
+	        this.since = this.convertValues(source["since"], null);
+	        this.until = this.convertValues(source["until"], null);
+	        this.limit = source["limit"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class LogLine {
+	    seq: number;
+	    text: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new LogLine(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.seq = source["seq"];
+	        this.text = source["text"];
+	    }
+	}
+	export class LogPage {
+	    lines: LogLine[];
+	    first: number;
+	    last: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new LogPage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.lines = this.convertValues(source["lines"], LogLine);
+	        this.first = source["first"];
+	        this.last = source["last"];
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class LogRecord {
+	    seq: number;
+	    // Go type: time
+	    time: any;
+	    level?: string;
+	    logger?: string;
+	    message: string;
+	    fields?: {[key: string]: string};
+	
+	    static createFrom(source: any = {}) {
+	        return new LogRecord(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.seq = source["seq"];
+	        this.time = this.convertValues(source["time"], null);
+	        this.level = source["level"];
+	        this.logger = source["logger"];
+	        this.message = source["message"];
+	        this.fields = source["fields"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class LaunchOptions {
 	    binPath?: string;
 	    data?: string;
@@ -15,6 +250,20 @@ export namespace backend {
 	    jwtAtExpire?: string;
 	    jwtRtExpire?: string;
 	    experiment?: boolean;
+	    stopTimeout?: string;
+	    readyTimeout?: string;
+	    healthInterval?: string;
+	    heartbeatInterval?: string;
+	    heartbeatMissLimit?: number;
+	    heartbeatAction?: string;
+	    restartPolicy?: string;
+	    restartMaxRetries?: number;
+	    restartBackoff?: string;
+	    restartBackoffMax?: string;
+	    navelcordLegacy?: boolean;
+	    flags?: {[key: string]: string};
+	    extraArgs?: string[];
+	    env?: {[key: string]: string | null};
 	
 	    static createFrom(source: any = {}) {
 	        return new LaunchOptions(source);
@@ -36,8 +285,106 @@ export namespace backend {
 	        this.jwtAtExpire = source["jwtAtExpire"];
 	        this.jwtRtExpire = source["jwtRtExpire"];
 	        this.experiment = source["experiment"];
+	        this.stopTimeout = source["stopTimeout"];
+	        this.readyTimeout = source["readyTimeout"];
+	        this.healthInterval = source["healthInterval"];
+	        this.heartbeatInterval = source["heartbeatInterval"];
+	        this.heartbeatMissLimit = source["heartbeatMissLimit"];
+	        this.heartbeatAction = source["heartbeatAction"];
+	        this.restartPolicy = source["restartPolicy"];
+	        this.restartMaxRetries = source["restartMaxRetries"];
+	        this.restartBackoff = source["restartBackoff"];
+	        this.restartBackoffMax = source["restartBackoffMax"];
+	        this.navelcordLegacy = source["navelcordLegacy"];
+	        this.flags = source["flags"];
+	        this.extraArgs = source["extraArgs"];
+	        this.env = source["env"];
+	    }
+	}
+	export class NeoCatInput {
+	    type: string;
+	    perCpu?: boolean;
+	    paths?: string[];
+	    interfaces?: string[];
+	    names?: string[];
+	    command?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new NeoCatInput(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.type = source["type"];
+	        this.perCpu = source["perCpu"];
+	        this.paths = source["paths"];
+	        this.interfaces = source["interfaces"];
+	        this.names = source["names"];
+	        this.command = source["command"];
 	    }
 	}
+	export class NeoCatOutput {
+	    type: string;
+	    format?: string;
+	    port?: number;
+	    tls?: boolean;
+	    insecure?: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new NeoCatOutput(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.type = source["type"];
+	        this.format = source["format"];
+	        this.port = source["port"];
+	        this.tls = source["tls"];
+	        this.insecure = source["insecure"];
+	    }
+	}
+	export class NeoCatCollector {
+	    name: string;
+	    interval?: string;
+	    prefix?: string;
+	    table?: string;
+	    inputs: NeoCatInput[];
+	    outputs?: NeoCatOutput[];
+	    outputFile?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new NeoCatCollector(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.interval = source["interval"];
+	        this.prefix = source["prefix"];
+	        this.table = source["table"];
+	        this.inputs = this.convertValues(source["inputs"], NeoCatInput);
+	        this.outputs = this.convertValues(source["outputs"], NeoCatOutput);
+	        this.outputFile = source["outputFile"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class NeoCatOptions {
 	    interval: string;
 	    prefix: string;
@@ -47,6 +394,11 @@ export namespace backend {
 	    outputFile?: string;
 	    pid: number;
 	    binPath?: string;
+	    autoStart?: boolean;
+	    token?: string;
+	    inputs?: NeoCatInput[];
+	    outputs?: NeoCatOutput[];
+	    collectors?: NeoCatCollector[];
 	
 	    static createFrom(source: any = {}) {
 	        return new NeoCatOptions(source);
@@ -62,7 +414,30 @@ export namespace backend {
 	        this.outputFile = source["outputFile"];
 	        this.pid = source["pid"];
 	        this.binPath = source["binPath"];
+	        this.autoStart = source["autoStart"];
+	        this.token = source["token"];
+	        this.inputs = this.convertValues(source["inputs"], NeoCatInput);
+	        this.outputs = this.convertValues(source["outputs"], NeoCatOutput);
+	        this.collectors = this.convertValues(source["collectors"], NeoCatCollector);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 
 }
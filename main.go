@@ -3,6 +3,7 @@ package main
 import (
 	"embed"
 	"net/http"
+	"os"
 	"strings"
 
 	"github.com/machbase/neo-launcher/backend"
@@ -19,6 +20,11 @@ var assets embed.FS
 var iconData []byte
 
 func main() {
+	// neo-launcher --headless, or neo-launcher start|stop|status|logs
+	if backend.IsHeadless(os.Args[1:]) {
+		os.Exit(backend.RunHeadless(os.Args[1:]))
+	}
+
 	// Create an instance of the app structure
 	app := backend.NewApp()
 